@@ -7,7 +7,11 @@ import (
 	"fmt"
 	"github.com/mat-sik/sql-distributed-transactions/api/internal/config"
 	commons "github.com/mat-sik/sql-distributed-transactions/common/transaction"
+	"io"
 	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
 )
 
 type Client struct {
@@ -22,22 +26,213 @@ func NewClient(ctx context.Context, client *http.Client) Client {
 	}
 }
 
-func (c Client) EnqueueTransaction(ctx context.Context, enqueueReq commons.EnqueueTransactionRequest) error {
-	body, err := json.Marshal(enqueueReq)
+func (c Client) EnqueueTransaction(ctx context.Context, enqueueReq commons.EnqueueTransactionRequest) (commons.EnqueueTransactionResponse, error) {
+	var enqueueResp commons.EnqueueTransactionResponse
+	err := c.do(ctx, http.MethodPost, "/transactions/enqueue", enqueueReq, &enqueueResp, http.StatusCreated, http.StatusOK)
 	if err != nil {
-		return err
+		return commons.EnqueueTransactionResponse{}, fmt.Errorf("failed to enqueue transaction: %w", err)
+	}
+	return enqueueResp, nil
+}
+
+// EnqueueTransactions enqueues up to commons.MaxBatchSize transactions with a single request. The transactions rejected
+// by the server are reported in their results, rather than as an error.
+func (c Client) EnqueueTransactions(ctx context.Context, enqueueReqs []commons.EnqueueTransactionRequest) (commons.EnqueueTransactionsResponse, error) {
+	var enqueueResp commons.EnqueueTransactionsResponse
+	err := c.do(ctx, http.MethodPost, "/transactions/enqueue:batch", enqueueReqs, &enqueueResp, http.StatusOK)
+	if err != nil {
+		return commons.EnqueueTransactionsResponse{}, fmt.Errorf("failed to enqueue transactions: %w", err)
 	}
+	return enqueueResp, nil
+}
+
+func (c Client) GetTransaction(ctx context.Context, id int) (commons.Transaction, error) {
+	var t commons.Transaction
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/transactions/%d", id), nil, &t, http.StatusOK); err != nil {
+		return commons.Transaction{}, fmt.Errorf("failed to get transaction: %w", err)
+	}
+	return t, nil
+}
+
+func (c Client) ListFailedTransactions(ctx context.Context, afterID int, limit int) (commons.ListTransactionsResponse, error) {
+	query := url.Values{}
+	query.Set("after_id", strconv.Itoa(afterID))
+	query.Set("limit", strconv.Itoa(limit))
 
-	url := fmt.Sprintf("%s/transactions/enqueue", c.serverConfig.URL)
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewBuffer(body))
+	var listResp commons.ListTransactionsResponse
+	if err := c.do(ctx, http.MethodGet, "/transactions/failed?"+query.Encode(), nil, &listResp, http.StatusOK); err != nil {
+		return commons.ListTransactionsResponse{}, fmt.Errorf("failed to list failed transactions: %w", err)
+	}
+	return listResp, nil
+}
+
+func (c Client) ListTransactions(ctx context.Context, filter commons.ListTransactionsFilter, afterID int, limit int) (commons.ListTransactionsResponse, error) {
+	query := filter.Values()
+	query.Set("after_id", strconv.Itoa(afterID))
+	query.Set("limit", strconv.Itoa(limit))
+
+	var listResp commons.ListTransactionsResponse
+	if err := c.do(ctx, http.MethodGet, "/transactions?"+query.Encode(), nil, &listResp, http.StatusOK); err != nil {
+		return commons.ListTransactionsResponse{}, fmt.Errorf("failed to list transactions: %w", err)
+	}
+	return listResp, nil
+}
+
+func (c Client) CountTransactions(ctx context.Context, filter commons.ListTransactionsFilter) (commons.CountTransactionsResponse, error) {
+	var countResp commons.CountTransactionsResponse
+	if err := c.do(ctx, http.MethodGet, "/transactions/counts?"+filter.Values().Encode(), nil, &countResp, http.StatusOK); err != nil {
+		return commons.CountTransactionsResponse{}, fmt.Errorf("failed to count transactions: %w", err)
+	}
+	return countResp, nil
+}
+
+func (c Client) RequeueTransaction(ctx context.Context, id int) (commons.Transaction, error) {
+	var t commons.Transaction
+	if err := c.do(ctx, http.MethodPost, fmt.Sprintf("/transactions/%d/requeue", id), nil, &t, http.StatusOK); err != nil {
+		return commons.Transaction{}, fmt.Errorf("failed to requeue transaction: %w", err)
+	}
+	return t, nil
+}
+
+func (c Client) CancelTransaction(ctx context.Context, id int) (commons.Transaction, error) {
+	var t commons.Transaction
+	if err := c.do(ctx, http.MethodPost, fmt.Sprintf("/transactions/%d/cancel", id), nil, &t, http.StatusOK); err != nil {
+		return commons.Transaction{}, fmt.Errorf("failed to cancel transaction: %w", err)
+	}
+	return t, nil
+}
+
+// ReplayTransactions replays a single chunk of the matching transactions. The next chunk is replayed by repeating the
+// request with the returned NextAfterID as its AfterID, until it is zero.
+func (c Client) ReplayTransactions(ctx context.Context, req commons.ReplayTransactionsRequest) (commons.ReplayTransactionsResponse, error) {
+	var replayResp commons.ReplayTransactionsResponse
+	if err := c.do(ctx, http.MethodPost, "/admin/transactions/replay", req, &replayResp, http.StatusOK); err != nil {
+		return commons.ReplayTransactionsResponse{}, fmt.Errorf("failed to replay transactions: %w", err)
+	}
+	return replayResp, nil
+}
+
+func (c Client) ListCircuitBreakers(ctx context.Context) (commons.ListCircuitBreakersResponse, error) {
+	var listResp commons.ListCircuitBreakersResponse
+	if err := c.do(ctx, http.MethodGet, "/admin/circuit-breakers", nil, &listResp, http.StatusOK); err != nil {
+		return commons.ListCircuitBreakersResponse{}, fmt.Errorf("failed to list circuit breakers: %w", err)
+	}
+	return listResp, nil
+}
+
+func (c Client) GetTransactionAttempts(ctx context.Context, id int) (commons.ListTransactionAttemptsResponse, error) {
+	var attemptsResp commons.ListTransactionAttemptsResponse
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/transactions/%d/attempts", id), nil, &attemptsResp, http.StatusOK); err != nil {
+		return commons.ListTransactionAttemptsResponse{}, fmt.Errorf("failed to get transaction attempts: %w", err)
+	}
+	return attemptsResp, nil
+}
+
+func (c Client) EnqueueSaga(ctx context.Context, enqueueReq commons.EnqueueSagaRequest) (commons.EnqueueSagaResponse, error) {
+	var enqueueResp commons.EnqueueSagaResponse
+	if err := c.do(ctx, http.MethodPost, "/sagas", enqueueReq, &enqueueResp, http.StatusCreated); err != nil {
+		return commons.EnqueueSagaResponse{}, fmt.Errorf("failed to enqueue saga: %w", err)
+	}
+	return enqueueResp, nil
+}
+
+func (c Client) GetSaga(ctx context.Context, id int) (commons.Saga, error) {
+	var saga commons.Saga
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/sagas/%d", id), nil, &saga, http.StatusOK); err != nil {
+		return commons.Saga{}, fmt.Errorf("failed to get saga: %w", err)
+	}
+	return saga, nil
+}
+
+func (c Client) EnqueueTwoPhaseCommit(ctx context.Context, enqueueReq commons.EnqueueTwoPhaseCommitRequest) (commons.EnqueueTwoPhaseCommitResponse, error) {
+	var enqueueResp commons.EnqueueTwoPhaseCommitResponse
+	if err := c.do(ctx, http.MethodPost, "/two-phase-commits", enqueueReq, &enqueueResp, http.StatusCreated); err != nil {
+		return commons.EnqueueTwoPhaseCommitResponse{}, fmt.Errorf("failed to enqueue two-phase commit: %w", err)
+	}
+	return enqueueResp, nil
+}
+
+func (c Client) GetTwoPhaseCommit(ctx context.Context, id int) (commons.TwoPhaseCommit, error) {
+	var commit commons.TwoPhaseCommit
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/two-phase-commits/%d", id), nil, &commit, http.StatusOK); err != nil {
+		return commons.TwoPhaseCommit{}, fmt.Errorf("failed to get two-phase commit: %w", err)
+	}
+	return commit, nil
+}
+
+func (c Client) CreateRecurringTransaction(ctx context.Context, req commons.RecurringTransactionRequest) (commons.RecurringTransaction, error) {
+	var t commons.RecurringTransaction
+	if err := c.do(ctx, http.MethodPost, "/recurring-transactions", req, &t, http.StatusCreated); err != nil {
+		return commons.RecurringTransaction{}, fmt.Errorf("failed to create recurring transaction: %w", err)
+	}
+	return t, nil
+}
+
+func (c Client) GetRecurringTransaction(ctx context.Context, id int) (commons.RecurringTransaction, error) {
+	var t commons.RecurringTransaction
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/recurring-transactions/%d", id), nil, &t, http.StatusOK); err != nil {
+		return commons.RecurringTransaction{}, fmt.Errorf("failed to get recurring transaction: %w", err)
+	}
+	return t, nil
+}
+
+func (c Client) ListRecurringTransactions(ctx context.Context, afterID int, limit int) (commons.ListRecurringTransactionsResponse, error) {
+	query := url.Values{}
+	query.Set("after_id", strconv.Itoa(afterID))
+	query.Set("limit", strconv.Itoa(limit))
+
+	var listResp commons.ListRecurringTransactionsResponse
+	if err := c.do(ctx, http.MethodGet, "/recurring-transactions?"+query.Encode(), nil, &listResp, http.StatusOK); err != nil {
+		return commons.ListRecurringTransactionsResponse{}, fmt.Errorf("failed to list recurring transactions: %w", err)
+	}
+	return listResp, nil
+}
+
+func (c Client) ReplaceRecurringTransaction(ctx context.Context, id int, req commons.RecurringTransactionRequest) (commons.RecurringTransaction, error) {
+	var t commons.RecurringTransaction
+	if err := c.do(ctx, http.MethodPut, fmt.Sprintf("/recurring-transactions/%d", id), req, &t, http.StatusOK); err != nil {
+		return commons.RecurringTransaction{}, fmt.Errorf("failed to replace recurring transaction: %w", err)
+	}
+	return t, nil
+}
+
+func (c Client) DeleteRecurringTransaction(ctx context.Context, id int) error {
+	if err := c.do(ctx, http.MethodDelete, fmt.Sprintf("/recurring-transactions/%d", id), nil, nil, http.StatusNoContent); err != nil {
+		return fmt.Errorf("failed to delete recurring transaction: %w", err)
+	}
+	return nil
+}
+
+func (c Client) do(ctx context.Context, method string, path string, reqBody any, respBody any, expectedCodes ...int) error {
+	var body io.Reader
+	if reqBody != nil {
+		encoded, err := json.Marshal(reqBody)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewBuffer(encoded)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.serverConfig.URL+path, body)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
 
 	resp, err := c.client.Do(req)
 	if err != nil {
 		return err
 	}
+	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("failed to enqueue transaction, received status code: %s", resp.Status)
+	if !slices.Contains(expectedCodes, resp.StatusCode) {
+		return fmt.Errorf("received status code: %s", resp.Status)
 	}
-	return nil
+
+	if respBody == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(respBody)
 }
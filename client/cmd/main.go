@@ -2,12 +2,14 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
 	"sync"
+	"time"
 
 	"github.com/cenkalti/backoff/v5"
 	api "github.com/mat-sik/sql-distributed-transactions/api/transaction"
@@ -65,8 +67,13 @@ func runClient(ctx context.Context, tracer trace.Tracer, clientConfig config.Cli
 	tClient := api.NewClient(ctx, client)
 	slog.Info("creating client", "config", clientConfig)
 
-	chSize := min(clientConfig.ToSend, maxChannelSize)
-	toSendCh := make(chan commons.EnqueueTransactionRequest, chSize)
+	// Every run gets its own idempotency key prefix, so that retried enqueues deduplicate within the run but do not
+	// collide with the transactions enqueued by the previous runs.
+	runID := time.Now().UnixNano()
+
+	batchSize := min(max(clientConfig.BatchSize, 1), commons.MaxBatchSize)
+	chSize := min(clientConfig.ToSend/batchSize+1, maxChannelSize)
+	toSendCh := make(chan []commons.EnqueueTransactionRequest, chSize)
 
 	wg := sync.WaitGroup{}
 	for i := 0; i < clientConfig.WorkerCount; i++ {
@@ -74,18 +81,22 @@ func runClient(ctx context.Context, tracer trace.Tracer, clientConfig config.Cli
 		go sendAll(ctx, tracer, &wg, tClient, toSendCh)
 	}
 
-	for i := 0; i < clientConfig.ToSend; i++ {
-		req := commons.EnqueueTransactionRequest{
-			Host:    clientConfig.DummyHost,
-			Path:    fmt.Sprintf("/call/%d", i),
-			Method:  "POST",
-			Payload: fmt.Sprintf(`{"iteration": %d}`, i),
+	for first := 0; first < clientConfig.ToSend; first += batchSize {
+		batch := make([]commons.EnqueueTransactionRequest, 0, batchSize)
+		for i := first; i < min(first+batchSize, clientConfig.ToSend); i++ {
+			batch = append(batch, commons.EnqueueTransactionRequest{
+				Host:           clientConfig.DummyHost,
+				Path:           fmt.Sprintf("/call/%d", i),
+				Method:         "POST",
+				Payload:        fmt.Sprintf(`{"iteration": %d}`, i),
+				IdempotencyKey: fmt.Sprintf("client-%d-%d", runID, i),
+			})
 		}
 		select {
 		case <-ctx.Done():
 			close(toSendCh)
 			return
-		case toSendCh <- req:
+		case toSendCh <- batch:
 		}
 	}
 	close(toSendCh)
@@ -93,40 +104,54 @@ func runClient(ctx context.Context, tracer trace.Tracer, clientConfig config.Cli
 	wg.Wait()
 }
 
-func sendAll(ctx context.Context, tracer trace.Tracer, wg *sync.WaitGroup, tClient api.Client, toSendCh chan commons.EnqueueTransactionRequest) {
+func sendAll(ctx context.Context, tracer trace.Tracer, wg *sync.WaitGroup, tClient api.Client, toSendCh chan []commons.EnqueueTransactionRequest) {
 	defer wg.Done()
 	for {
 		select {
 		case <-ctx.Done():
 			return
-		case req, ok := <-toSendCh:
+		case batch, ok := <-toSendCh:
 			if !ok {
 				return
 			}
-			send(ctx, tracer, tClient, req)
+			send(ctx, tracer, tClient, batch)
 		}
 	}
 }
 
-func send(ctx context.Context, tracer trace.Tracer, tClient api.Client, req commons.EnqueueTransactionRequest) {
+func send(ctx context.Context, tracer trace.Tracer, tClient api.Client, batch []commons.EnqueueTransactionRequest) {
 	ctx, span := tracer.Start(ctx, "send")
 	defer span.End()
 
-	operation := func() (struct{}, error) {
-		return struct{}{}, tClient.EnqueueTransaction(ctx, req)
+	operation := func() (commons.EnqueueTransactionsResponse, error) {
+		return tClient.EnqueueTransactions(ctx, batch)
 	}
 
-	span.AddEvent("Trying to send transaction request", trace.WithAttributes(
-		attribute.String("transaction request payload", req.Payload),
+	span.AddEvent("Trying to send transaction requests", trace.WithAttributes(
+		attribute.Int("transaction count", len(batch)),
 	))
 
-	_, err := backoff.Retry(ctx, operation, backoff.WithBackOff(backoff.NewExponentialBackOff()), backoff.WithMaxTries(5))
+	resp, err := backoff.Retry(ctx, operation, backoff.WithBackOff(backoff.NewExponentialBackOff()), backoff.WithMaxTries(5))
 	if err != nil {
-		span.SetStatus(codes.Error, "Failed to enqueue transaction")
+		span.SetStatus(codes.Error, "Failed to enqueue transactions")
 		span.RecordError(err, trace.WithAttributes(
-			attribute.String("request payload", req.Payload),
+			attribute.Int("transaction count", len(batch)),
 		))
+		return
+	}
+
+	for i, result := range resp.Results {
+		if result.Error != "" {
+			span.SetStatus(codes.Error, "Some of the transactions have been rejected")
+			span.RecordError(errors.New(result.Error), trace.WithAttributes(
+				attribute.String("request payload", batch[i].Payload),
+			))
+		}
 	}
+
+	span.AddEvent("Enqueued the transactions", trace.WithAttributes(
+		attribute.Int("transaction count", len(resp.Results)),
+	))
 }
 
 const (
@@ -9,6 +9,8 @@ type Client struct {
 	DummyHost   string `env:"DUMMY_HOST, default=localhost:40691"`
 	ToSend      int    `env:"CLIENT_TO_SEND, default=100_000"`
 	WorkerCount int    `env:"CLIENT_WORKER_COUNT, default=2"`
+	// BatchSize is the number of transactions enqueued with a single request.
+	BatchSize int `env:"CLIENT_BATCH_SIZE, default=500"`
 }
 
 func NewClientConfig(ctx context.Context) (Client, error) {
@@ -22,7 +22,7 @@ import (
 	semconv "go.opentelemetry.io/otel/semconv/v1.34.0"
 )
 
-func InitOTelSDK(ctx context.Context, collectorHost string, serviceName string) (ShutdownFunc, error) {
+func InitOTelSDK(ctx context.Context, collectorHost string, serviceName string, readers ...metric.Reader) (ShutdownFunc, error) {
 	var err error
 	var shutdownFuncs []ShutdownFunc
 
@@ -66,7 +66,7 @@ func InitOTelSDK(ctx context.Context, collectorHost string, serviceName string)
 	shutdownFuncs = append(shutdownFuncs, tracerProvider.Shutdown)
 	otel.SetTracerProvider(tracerProvider)
 
-	meterProvider, err := newMeterProvider(ctx, res, exporterConn)
+	meterProvider, err := newMeterProvider(ctx, res, exporterConn, readers)
 	if err != nil {
 		err = shutdownAndHandleError(err)
 		return nil, err
@@ -131,19 +131,23 @@ func newTracerProvider(ctx context.Context, res *resource.Resource, conn *grpc.C
 	return tracerProvider, nil
 }
 
-func newMeterProvider(ctx context.Context, res *resource.Resource, conn *grpc.ClientConn) (*metric.MeterProvider, error) {
+func newMeterProvider(ctx context.Context, res *resource.Resource, conn *grpc.ClientConn, readers []metric.Reader) (*metric.MeterProvider, error) {
 	metricExporter, err := otlpmetricgrpc.New(ctx, otlpmetricgrpc.WithGRPCConn(conn))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create metrics exporter: %w", err)
 	}
 
-	meterProvider := metric.NewMeterProvider(
+	options := []metric.Option{
 		metric.WithReader(metric.NewPeriodicReader(
 			metricExporter,
 			metric.WithInterval(100*time.Millisecond),
 		)),
 		metric.WithResource(res),
-	)
+	}
+	for _, reader := range readers {
+		options = append(options, metric.WithReader(reader))
+	}
+	meterProvider := metric.NewMeterProvider(options...)
 	otel.SetMeterProvider(meterProvider)
 
 	return meterProvider, nil
@@ -0,0 +1,67 @@
+package transaction
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestDurationUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    Duration
+		wantErr bool
+	}{
+		{name: "string", data: `"15m"`, want: Duration(15 * time.Minute)},
+		{name: "compound string", data: `"1h30m"`, want: Duration(90 * time.Minute)},
+		{name: "seconds", data: `90`, want: Duration(90 * time.Second)},
+		{name: "fractional seconds", data: `1.5`, want: Duration(1500 * time.Millisecond)},
+		{name: "zero", data: `0`, want: 0},
+		{name: "string without a unit", data: `"90"`, wantErr: true},
+		{name: "invalid string", data: `"soon"`, wantErr: true},
+		{name: "boolean", data: `true`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got Duration
+			err := json.Unmarshal([]byte(tt.data), &got)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Unmarshal() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Unmarshal() = %v, want %v", time.Duration(got), time.Duration(tt.want))
+			}
+		})
+	}
+}
+
+func TestDurationMarshalJSON(t *testing.T) {
+	tests := []struct {
+		name     string
+		duration Duration
+		want     string
+	}{
+		{name: "minutes", duration: Duration(15 * time.Minute), want: `"15m0s"`},
+		{name: "fractional seconds", duration: Duration(1500 * time.Millisecond), want: `"1.5s"`},
+		{name: "zero", duration: 0, want: `"0s"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := json.Marshal(tt.duration)
+			if err != nil {
+				t.Fatalf("Marshal() error = %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("Marshal() = %s, want %s", got, tt.want)
+			}
+
+			var roundTrip Duration
+			if err = json.Unmarshal(got, &roundTrip); err != nil || roundTrip != tt.duration {
+				t.Errorf("Unmarshal(%s) = (%v, %v), want %v", got, time.Duration(roundTrip), err, time.Duration(tt.duration))
+			}
+		})
+	}
+}
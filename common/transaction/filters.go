@@ -0,0 +1,98 @@
+package transaction
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// ListTransactionsFilter narrows down the listed and counted transactions. Fields left empty match every transaction.
+// A transaction matches when it is in any of the States and its last status code is any of the StatusCodes. The time
+// ranges include their start and exclude their end.
+type ListTransactionsFilter struct {
+	States        []string   `json:"states,omitempty"`
+	Host          string     `json:"host,omitempty"`
+	Method        string     `json:"method,omitempty"`
+	OrderingKey   string     `json:"ordering_key,omitempty"`
+	StatusCodes   []int      `json:"status_codes,omitempty"`
+	CreatedAfter  *time.Time `json:"created_after,omitempty"`
+	CreatedBefore *time.Time `json:"created_before,omitempty"`
+	UpdatedAfter  *time.Time `json:"updated_after,omitempty"`
+	UpdatedBefore *time.Time `json:"updated_before,omitempty"`
+}
+
+// Values encodes the filter as the query parameters of the listing endpoints.
+func (f ListTransactionsFilter) Values() url.Values {
+	values := url.Values{}
+	for _, s := range f.States {
+		values.Add("state", s)
+	}
+	setIfNotEmpty(values, "host", f.Host)
+	setIfNotEmpty(values, "method", f.Method)
+	setIfNotEmpty(values, "ordering_key", f.OrderingKey)
+	for _, code := range f.StatusCodes {
+		values.Add("status_code", strconv.Itoa(code))
+	}
+	setTimeIfNotNil(values, "created_after", f.CreatedAfter)
+	setTimeIfNotNil(values, "created_before", f.CreatedBefore)
+	setTimeIfNotNil(values, "updated_after", f.UpdatedAfter)
+	setTimeIfNotNil(values, "updated_before", f.UpdatedBefore)
+	return values
+}
+
+func ParseListTransactionsFilter(values url.Values) (ListTransactionsFilter, error) {
+	f := ListTransactionsFilter{
+		States:      values["state"],
+		Host:        values.Get("host"),
+		Method:      values.Get("method"),
+		OrderingKey: values.Get("ordering_key"),
+	}
+
+	for _, value := range values["status_code"] {
+		code, err := strconv.Atoi(value)
+		if err != nil {
+			return ListTransactionsFilter{}, fmt.Errorf("status_code must be an integer: %w", err)
+		}
+		f.StatusCodes = append(f.StatusCodes, code)
+	}
+
+	var err error
+	if f.CreatedAfter, err = parseTime(values, "created_after"); err != nil {
+		return ListTransactionsFilter{}, err
+	}
+	if f.CreatedBefore, err = parseTime(values, "created_before"); err != nil {
+		return ListTransactionsFilter{}, err
+	}
+	if f.UpdatedAfter, err = parseTime(values, "updated_after"); err != nil {
+		return ListTransactionsFilter{}, err
+	}
+	if f.UpdatedBefore, err = parseTime(values, "updated_before"); err != nil {
+		return ListTransactionsFilter{}, err
+	}
+	return f, nil
+}
+
+func setIfNotEmpty(values url.Values, name string, value string) {
+	if value != "" {
+		values.Set(name, value)
+	}
+}
+
+func setTimeIfNotNil(values url.Values, name string, value *time.Time) {
+	if value != nil {
+		values.Set(name, value.Format(time.RFC3339Nano))
+	}
+}
+
+func parseTime(values url.Values, name string) (*time.Time, error) {
+	value := values.Get(name)
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be an RFC 3339 time: %w", name, err)
+	}
+	return &t, nil
+}
@@ -0,0 +1,73 @@
+package transaction
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestListTransactionsFilterValues(t *testing.T) {
+	createdAfter := time.Date(2025, 3, 10, 12, 30, 0, 500, time.UTC)
+	updatedBefore := time.Date(2025, 3, 11, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		filter ListTransactionsFilter
+		want   string
+	}{
+		{
+			name:   "empty",
+			filter: ListTransactionsFilter{},
+			want:   "",
+		},
+		{
+			name: "every field",
+			filter: ListTransactionsFilter{
+				States:        []string{"RETRY", "FAILED"},
+				Host:          "dummy:40691",
+				Method:        "POST",
+				OrderingKey:   "account-42",
+				StatusCodes:   []int{500, 503},
+				CreatedAfter:  &createdAfter,
+				UpdatedBefore: &updatedBefore,
+			},
+			want: "created_after=2025-03-10T12%3A30%3A00.0000005Z&host=dummy%3A40691&method=POST&" +
+				"ordering_key=account-42&state=RETRY&state=FAILED&status_code=500&status_code=503&" +
+				"updated_before=2025-03-11T00%3A00%3A00Z",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values := tt.filter.Values()
+			if got := values.Encode(); got != tt.want {
+				t.Errorf("Values() = %s, want %s", got, tt.want)
+			}
+
+			parsed, err := ParseListTransactionsFilter(values)
+			if err != nil {
+				t.Fatalf("ParseListTransactionsFilter() error = %v", err)
+			}
+			if !reflect.DeepEqual(parsed, tt.filter) {
+				t.Errorf("ParseListTransactionsFilter() = %+v, want %+v", parsed, tt.filter)
+			}
+		})
+	}
+}
+
+func TestParseListTransactionsFilterRejectsInvalidStatusCode(t *testing.T) {
+	if _, err := ParseListTransactionsFilter(url.Values{"status_code": {"5xx"}}); err == nil {
+		t.Error("ParseListTransactionsFilter() error = nil, want the status code rejected")
+	}
+}
+
+func TestParseListTransactionsFilterRejectsInvalidTime(t *testing.T) {
+	for _, name := range []string{"created_after", "created_before", "updated_after", "updated_before"} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := ParseListTransactionsFilter(url.Values{name: {"yesterday"}}); err == nil {
+				t.Errorf("ParseListTransactionsFilter() error = nil, want the %s time rejected", name)
+			}
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package transaction
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// RecurringTransactionRequest defines a transaction which is enqueued repeatedly, either according to a cron
+// Schedule, e.g. "0 2 * * *" or "@hourly", or every Interval. Schedules are in UTC unless prefixed with CRON_TZ.
+type RecurringTransactionRequest struct {
+	Schedule    string                    `json:"schedule,omitempty"`
+	Interval    Duration                  `json:"interval,omitempty"`
+	Transaction EnqueueTransactionRequest `json:"transaction"`
+}
+
+func ValidRecurringTransactionRequest(request RecurringTransactionRequest) error {
+	var errs []error
+	if (request.Schedule == "") == (request.Interval == 0) {
+		errs = append(errs, errors.New("exactly one of schedule and interval must be set"))
+	}
+	if request.Interval < 0 || request.Interval > 0 && time.Duration(request.Interval) < time.Second {
+		errs = append(errs, errors.New("interval must be at least one second"))
+	}
+	if request.Transaction.NotBefore != nil || request.Transaction.ExpiresAt != nil {
+		errs = append(errs, errors.New("recurring transactions accept only relative delays and ttls"))
+	}
+	if err := validCoordinatedCall(request.Transaction); err != nil {
+		errs = append(errs, fmt.Errorf("transaction: %w", err))
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+	return nil
+}
+
+type RecurringTransaction struct {
+	ID                int                       `json:"id"`
+	Schedule          string                    `json:"schedule,omitempty"`
+	Interval          Duration                  `json:"interval,omitempty"`
+	Transaction       EnqueueTransactionRequest `json:"transaction"`
+	NextFireAt        time.Time                 `json:"next_fire_at"`
+	LastFiredAt       *time.Time                `json:"last_fired_at,omitempty"`
+	LastTransactionID *int                      `json:"last_transaction_id,omitempty"`
+	CreatedAt         time.Time                 `json:"created_at"`
+	UpdatedAt         time.Time                 `json:"updated_at"`
+}
+
+type ListRecurringTransactionsResponse struct {
+	RecurringTransactions []RecurringTransaction `json:"recurring_transactions"`
+}
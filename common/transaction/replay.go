@@ -0,0 +1,63 @@
+package transaction
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+const (
+	// ReplayModeReset moves the matching transactions back to PENDING with a fresh attempt counter. Each replay is
+	// delivered with the idempotency key of the transaction suffixed by -replay-<n>, so the downstream does not discard
+	// it as a duplicate of the earlier delivery.
+	ReplayModeReset = "reset"
+	// ReplayModeClone enqueues a copy of each matching transaction, and leaves the originals as they are.
+	ReplayModeClone = "clone"
+)
+
+// ReplayTransactionsRequest selects finished transactions to be delivered again, either by their IDs or by a filter.
+// Only the transactions in the DONE, FAILED, EXPIRED or CANCELLED states which belong to neither a saga nor a
+// two-phase commit are replayed. A request replays at most Limit transactions with IDs above AfterID, so a large range
+// is replayed by repeating the request with the returned NextAfterID.
+type ReplayTransactionsRequest struct {
+	IDs     []int                   `json:"ids,omitempty"`
+	Filter  *ListTransactionsFilter `json:"filter,omitempty"`
+	Mode    string                  `json:"mode,omitempty"`
+	DryRun  bool                    `json:"dry_run,omitempty"`
+	AfterID int                     `json:"after_id,omitempty"`
+	Limit   int                     `json:"limit,omitempty"`
+}
+
+func ValidReplayRequest(request ReplayTransactionsRequest) error {
+	var errs []error
+	emptyFilter := request.Filter == nil || reflect.ValueOf(*request.Filter).IsZero()
+	if len(request.IDs) == 0 && emptyFilter {
+		errs = append(errs, errors.New("either ids or a filter must be given"))
+	}
+	if len(request.IDs) > MaxBatchSize {
+		errs = append(errs, fmt.Errorf("at most %d ids can be given", MaxBatchSize))
+	}
+	if request.Mode != "" && request.Mode != ReplayModeReset && request.Mode != ReplayModeClone {
+		errs = append(errs, fmt.Errorf("mode must be either %s or %s", ReplayModeReset, ReplayModeClone))
+	}
+	if request.AfterID < 0 {
+		errs = append(errs, errors.New("after id must not be negative"))
+	}
+	if request.Limit < 0 || request.Limit > MaxBatchSize {
+		errs = append(errs, fmt.Errorf("limit must be between 1 and %d, or left out for the default", MaxBatchSize))
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+	return nil
+}
+
+// ReplayTransactionsResponse reports the number of matching transactions, which on a dry run is not bounded by the
+// limit. Otherwise, it holds the IDs of the transactions which are going to be delivered again, which for the clone
+// mode are the IDs of the copies.
+type ReplayTransactionsResponse struct {
+	Matched        int   `json:"matched"`
+	TransactionIDs []int `json:"transaction_ids"`
+	// NextAfterID is the after_id of the next chunk, and is left out on the last one.
+	NextAfterID int `json:"next_after_id,omitempty"`
+}
@@ -0,0 +1,73 @@
+package transaction
+
+import "testing"
+
+func TestValidReplayRequest(t *testing.T) {
+	ids := make([]int, MaxBatchSize+1)
+
+	tests := []struct {
+		name    string
+		request ReplayTransactionsRequest
+		wantErr bool
+	}{
+		{
+			name:    "ids",
+			request: ReplayTransactionsRequest{IDs: []int{1, 2}},
+		},
+		{
+			name:    "filter",
+			request: ReplayTransactionsRequest{Filter: &ListTransactionsFilter{States: []string{"FAILED"}}, Mode: ReplayModeClone},
+		},
+		{
+			name:    "neither ids nor a filter",
+			request: ReplayTransactionsRequest{Mode: ReplayModeReset},
+			wantErr: true,
+		},
+		{
+			name:    "empty filter",
+			request: ReplayTransactionsRequest{Filter: &ListTransactionsFilter{}},
+			wantErr: true,
+		},
+		{
+			name:    "too many ids",
+			request: ReplayTransactionsRequest{IDs: ids},
+			wantErr: true,
+		},
+		{
+			name:    "unknown mode",
+			request: ReplayTransactionsRequest{IDs: []int{1}, Mode: "move"},
+			wantErr: true,
+		},
+		{
+			name:    "negative after id",
+			request: ReplayTransactionsRequest{IDs: []int{1}, AfterID: -1},
+			wantErr: true,
+		},
+		{
+			name:    "default limit",
+			request: ReplayTransactionsRequest{IDs: []int{1}, Limit: 0},
+		},
+		{
+			name:    "maximum limit",
+			request: ReplayTransactionsRequest{IDs: []int{1}, Limit: MaxBatchSize},
+		},
+		{
+			name:    "limit above the maximum",
+			request: ReplayTransactionsRequest{IDs: []int{1}, Limit: MaxBatchSize + 1},
+			wantErr: true,
+		},
+		{
+			name:    "negative limit",
+			request: ReplayTransactionsRequest{IDs: []int{1}, Limit: -1},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidReplayRequest(tt.request); (err != nil) != tt.wantErr {
+				t.Errorf("ValidReplayRequest() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
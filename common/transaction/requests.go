@@ -3,19 +3,52 @@ package transaction
 import (
 	"errors"
 	"fmt"
+	"mime"
 	"net/http"
+	"slices"
 	"strings"
+	"time"
 )
 
+const IdempotencyKeyHeader = "Idempotency-Key"
+
 type EnqueueTransactionRequest struct {
-	Host    string `json:"host"`
-	Path    string `json:"path"`
-	Method  string `json:"method"`
-	Payload string `json:"payload"`
+	// Scheme is either http or https, and defaults to http.
+	Scheme         string `json:"scheme,omitempty"`
+	Host           string `json:"host"`
+	Path           string `json:"path"`
+	Method         string `json:"method"`
+	Payload        string `json:"payload"`
+	IdempotencyKey string `json:"idempotency_key,omitempty"`
+	// OrderingKey groups transactions which are sent one at a time, in the order they have been enqueued. A transaction
+	// is not sent until every earlier transaction with the same key is either done or has failed terminally.
+	OrderingKey string `json:"ordering_key,omitempty"`
+	// Priority orders the due transactions, the higher ones are sent first. A transaction which keeps waiting is
+	// gradually raised, so the lower ones still make progress under load.
+	Priority    int `json:"priority,omitempty"`
+	MaxAttempts int `json:"max_attempts,omitempty"`
+	// RetryOn and FailOn override the server-wide classification of the remote call outcomes. Outcomes matching
+	// neither of them mark the transaction as done.
+	RetryOn []StatusSelector `json:"retry_on,omitempty"`
+	FailOn  []StatusSelector `json:"fail_on,omitempty"`
+	// NotBefore and Delay postpone the first attempt, either until the given time, or by the given duration from the
+	// enqueue. At most one of them can be set.
+	NotBefore *time.Time `json:"not_before,omitempty"`
+	Delay     Duration   `json:"delay,omitempty"`
+	// ExpiresAt and TTL set a deadline after which the transaction is abandoned instead of being sent, either at the
+	// given time, or after the given duration from the enqueue. At most one of them can be set.
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	TTL       Duration   `json:"ttl,omitempty"`
+	// Headers are sent with every attempt. ContentType defaults to application/json when a payload is present.
+	Headers     map[string]string `json:"headers,omitempty"`
+	ContentType string            `json:"content_type,omitempty"`
 }
 
 func ValidRequest(request EnqueueTransactionRequest) error {
 	var errs []error
+	if !isValidScheme(request.Scheme) {
+		errs = append(errs, fmt.Errorf("scheme %s is invalid", request.Scheme))
+	}
 	if request.Host == "" {
 		errs = append(errs, errors.New("host is required"))
 	}
@@ -28,12 +61,63 @@ func ValidRequest(request EnqueueTransactionRequest) error {
 	if !isValidHTTPMethod(request.Method) {
 		errs = append(errs, fmt.Errorf("method %s is invalid", request.Method))
 	}
+	if len(request.IdempotencyKey) > maxIdempotencyKeyLength {
+		errs = append(errs, fmt.Errorf("idempotency key must be at most %d characters long", maxIdempotencyKeyLength))
+	}
+	if isReservedIdempotencyKey(request.IdempotencyKey) {
+		errs = append(errs, fmt.Errorf("idempotency key %s uses a prefix reserved by the server", request.IdempotencyKey))
+	}
+	if len(request.OrderingKey) > maxOrderingKeyLength {
+		errs = append(errs, fmt.Errorf("ordering key must be at most %d characters long", maxOrderingKeyLength))
+	}
+	if request.Priority < MinPriority || request.Priority > MaxPriority {
+		errs = append(errs, fmt.Errorf("priority must be between %d and %d", MinPriority, MaxPriority))
+	}
+	if request.MaxAttempts < 0 {
+		errs = append(errs, errors.New("max attempts must not be negative"))
+	}
+	for _, selector := range slices.Concat(request.RetryOn, request.FailOn) {
+		if err := selector.Validate(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if request.NotBefore != nil && request.Delay != 0 {
+		errs = append(errs, errors.New("not before and delay cannot be set together"))
+	}
+	if request.Delay < 0 {
+		errs = append(errs, errors.New("delay must not be negative"))
+	}
+	if request.ExpiresAt != nil && request.TTL != 0 {
+		errs = append(errs, errors.New("expires at and ttl cannot be set together"))
+	}
+	if request.TTL < 0 {
+		errs = append(errs, errors.New("ttl must not be negative"))
+	}
+	if request.ContentType != "" {
+		if _, _, err := mime.ParseMediaType(request.ContentType); err != nil {
+			errs = append(errs, fmt.Errorf("content type %s is invalid: %w", request.ContentType, err))
+		}
+	}
+	for name, value := range request.Headers {
+		if err := validHeader(name, value); err != nil {
+			errs = append(errs, err)
+		}
+	}
 	if len(errs) > 0 {
 		return errors.Join(errs...)
 	}
 	return nil
 }
 
+func isValidScheme(scheme string) bool {
+	switch strings.ToLower(scheme) {
+	case "", "http", "https":
+		return true
+	default:
+		return false
+	}
+}
+
 func isValidHTTPMethod(method string) bool {
 	switch strings.ToUpper(method) {
 	case http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete,
@@ -43,3 +127,79 @@ func isValidHTTPMethod(method string) bool {
 		return false
 	}
 }
+
+func validHeader(name string, value string) error {
+	if name == "" || strings.IndexFunc(name, func(r rune) bool { return !isTokenRune(r) }) != -1 {
+		return fmt.Errorf("header name %q is invalid", name)
+	}
+	if strings.ContainsAny(value, "\r\n\x00") {
+		return fmt.Errorf("header %s has an invalid value", name)
+	}
+	if slices.Contains(forbiddenHeaders, http.CanonicalHeaderKey(name)) {
+		return fmt.Errorf("header %s cannot be set", name)
+	}
+	return nil
+}
+
+func isTokenRune(r rune) bool {
+	if r > 0x7f {
+		return false
+	}
+	if 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9' {
+		return true
+	}
+	return strings.ContainsRune("!#$%&'*+-.^_`|~", r)
+}
+
+// forbiddenHeaders are either hop-by-hop headers, which only apply to a single connection, or headers managed by the
+// server itself.
+var forbiddenHeaders = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Proxy-Connection",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+	"Host",
+	"Content-Length",
+	"Content-Type",
+	IdempotencyKeyHeader,
+}
+
+const (
+	MinPriority = -100
+	MaxPriority = 100
+)
+
+// MaxBatchSize is the maximum number of transactions enqueued with a single batch request.
+const MaxBatchSize = 1000
+
+const (
+	maxIdempotencyKeyLength = 255
+	maxOrderingKeyLength    = 255
+)
+
+// The idempotency keys which the server assigns to the calls it enqueues on behalf of the sagas and the two-phase
+// commits, and to the fires of the recurring transactions, start with these prefixes.
+const (
+	SagaIdempotencyKeyPrefix           = "saga-"
+	TwoPhaseCommitIdempotencyKeyPrefix = "2pc-"
+	RecurringIdempotencyKeyPrefix      = "recurring-"
+)
+
+// reservedIdempotencyKeyPrefixes cannot be used by the clients, so their keys never collide with the ones assigned by
+// the server.
+var reservedIdempotencyKeyPrefixes = []string{
+	SagaIdempotencyKeyPrefix,
+	TwoPhaseCommitIdempotencyKeyPrefix,
+	RecurringIdempotencyKeyPrefix,
+}
+
+func isReservedIdempotencyKey(key string) bool {
+	return slices.ContainsFunc(reservedIdempotencyKeyPrefixes, func(prefix string) bool {
+		return strings.HasPrefix(key, prefix)
+	})
+}
@@ -0,0 +1,106 @@
+package transaction
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidRequest(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(request *EnqueueTransactionRequest)
+		wantErr bool
+	}{
+		{
+			name:   "valid",
+			modify: func(request *EnqueueTransactionRequest) {},
+		},
+		{
+			name:    "missing host",
+			modify:  func(request *EnqueueTransactionRequest) { request.Host = "" },
+			wantErr: true,
+		},
+		{
+			name:    "invalid method",
+			modify:  func(request *EnqueueTransactionRequest) { request.Method = "FETCH" },
+			wantErr: true,
+		},
+		{
+			name:   "ordering key",
+			modify: func(request *EnqueueTransactionRequest) { request.OrderingKey = "account-42" },
+		},
+		{
+			name:    "ordering key too long",
+			modify:  func(request *EnqueueTransactionRequest) { request.OrderingKey = strings.Repeat("k", 256) },
+			wantErr: true,
+		},
+		{
+			name:   "max attempts",
+			modify: func(request *EnqueueTransactionRequest) { request.MaxAttempts = 3 },
+		},
+		{
+			name:    "negative max attempts",
+			modify:  func(request *EnqueueTransactionRequest) { request.MaxAttempts = -1 },
+			wantErr: true,
+		},
+		{
+			name:   "delay",
+			modify: func(request *EnqueueTransactionRequest) { request.Delay = Duration(time.Minute) },
+		},
+		{
+			name: "not before",
+			modify: func(request *EnqueueTransactionRequest) {
+				notBefore := time.Date(2025, 3, 10, 12, 30, 0, 0, time.UTC)
+				request.NotBefore = &notBefore
+			},
+		},
+		{
+			name: "not before and delay together",
+			modify: func(request *EnqueueTransactionRequest) {
+				notBefore := time.Date(2025, 3, 10, 12, 30, 0, 0, time.UTC)
+				request.NotBefore = &notBefore
+				request.Delay = Duration(time.Minute)
+			},
+			wantErr: true,
+		},
+		{
+			name:    "negative delay",
+			modify:  func(request *EnqueueTransactionRequest) { request.Delay = Duration(-time.Minute) },
+			wantErr: true,
+		},
+		{
+			name:   "ttl",
+			modify: func(request *EnqueueTransactionRequest) { request.TTL = Duration(time.Hour) },
+		},
+		{
+			name: "expires at and ttl together",
+			modify: func(request *EnqueueTransactionRequest) {
+				expiresAt := time.Date(2025, 3, 10, 12, 30, 0, 0, time.UTC)
+				request.ExpiresAt = &expiresAt
+				request.TTL = Duration(time.Hour)
+			},
+			wantErr: true,
+		},
+		{
+			name:    "negative ttl",
+			modify:  func(request *EnqueueTransactionRequest) { request.TTL = Duration(-time.Hour) },
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := EnqueueTransactionRequest{
+				Host:    "dummy:40691",
+				Path:    "/transactions",
+				Method:  "POST",
+				Payload: `{"amount": 10}`,
+			}
+			tt.modify(&request)
+			if err := ValidRequest(request); (err != nil) != tt.wantErr {
+				t.Errorf("ValidRequest() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
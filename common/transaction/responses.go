@@ -0,0 +1,80 @@
+package transaction
+
+import "time"
+
+type EnqueueTransactionResponse struct {
+	ID int `json:"id"`
+}
+
+type Transaction struct {
+	ID             int        `json:"id"`
+	Scheme         string     `json:"scheme"`
+	Host           string     `json:"host"`
+	Path           string     `json:"path"`
+	Method         string     `json:"method"`
+	IdempotencyKey string     `json:"idempotency_key,omitempty"`
+	OrderingKey    string     `json:"ordering_key,omitempty"`
+	Priority       int        `json:"priority"`
+	State          string     `json:"state"`
+	Attempts       int        `json:"attempts"`
+	MaxAttempts    *int       `json:"max_attempts,omitempty"`
+	LastStatusCode *int       `json:"last_status_code,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+	NextAttemptAt  time.Time  `json:"next_attempt_at"`
+	ExpiresAt      *time.Time `json:"expires_at,omitempty"`
+	LastAttemptAt  *time.Time `json:"last_attempt_at,omitempty"`
+}
+
+type TransactionAttempt struct {
+	Attempt         int                 `json:"attempt"`
+	StartedAt       time.Time           `json:"started_at"`
+	FinishedAt      time.Time           `json:"finished_at"`
+	StatusCode      *int                `json:"status_code,omitempty"`
+	ResponseHeaders map[string][]string `json:"response_headers,omitempty"`
+	ResponseBody    string              `json:"response_body,omitempty"`
+	Error           string              `json:"error,omitempty"`
+}
+
+type ListTransactionAttemptsResponse struct {
+	Attempts []TransactionAttempt `json:"attempts"`
+}
+
+// EnqueueTransactionsResponse holds a result for each of the enqueued transactions, in the order of the request.
+type EnqueueTransactionsResponse struct {
+	Results []EnqueueTransactionResult `json:"results"`
+}
+
+// EnqueueTransactionResult holds either the ID of the transaction, or the reason it has been rejected. Created is
+// false when a transaction with the same idempotency key had already been enqueued.
+type EnqueueTransactionResult struct {
+	ID      int    `json:"id,omitempty"`
+	Created bool   `json:"created,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// CircuitBreaker is the state of the circuit of a remote host. Requests and Failures are counted within the current
+// window, and OpenedAt is set while the circuit is not closed.
+type CircuitBreaker struct {
+	Host     string     `json:"host"`
+	State    string     `json:"state"`
+	Requests int        `json:"requests"`
+	Failures int        `json:"failures"`
+	OpenedAt *time.Time `json:"opened_at,omitempty"`
+}
+
+type ListCircuitBreakersResponse struct {
+	CircuitBreakers []CircuitBreaker `json:"circuit_breakers"`
+}
+
+type ListTransactionsResponse struct {
+	Transactions []Transaction `json:"transactions"`
+	// NextAfterID is the after_id of the next page, and is left out on the last page.
+	NextAfterID int `json:"next_after_id,omitempty"`
+}
+
+// CountTransactionsResponse holds the number of matching transactions in each of the states they are in.
+type CountTransactionsResponse struct {
+	Counts map[string]int `json:"counts"`
+	Total  int            `json:"total"`
+}
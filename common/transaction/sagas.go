@@ -0,0 +1,68 @@
+package transaction
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+type EnqueueSagaRequest struct {
+	Steps []SagaStepRequest `json:"steps"`
+}
+
+// SagaStepRequest is a step of a saga. When a later step fails, the Compensation of every completed step is sent in
+// reverse order.
+type SagaStepRequest struct {
+	Forward      EnqueueTransactionRequest  `json:"forward"`
+	Compensation *EnqueueTransactionRequest `json:"compensation,omitempty"`
+}
+
+func ValidSagaRequest(request EnqueueSagaRequest) error {
+	var errs []error
+	if len(request.Steps) == 0 {
+		errs = append(errs, errors.New("saga must have at least one step"))
+	}
+	for i, step := range request.Steps {
+		if err := validCoordinatedCall(step.Forward); err != nil {
+			errs = append(errs, fmt.Errorf("step %d forward: %w", i, err))
+		}
+		if step.Compensation == nil {
+			continue
+		}
+		if err := validCoordinatedCall(*step.Compensation); err != nil {
+			errs = append(errs, fmt.Errorf("step %d compensation: %w", i, err))
+		}
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+	return nil
+}
+
+// validCoordinatedCall validates a call which the server enqueues itself, on behalf of a saga, a two-phase commit or a
+// recurring transaction.
+func validCoordinatedCall(request EnqueueTransactionRequest) error {
+	if request.IdempotencyKey != "" {
+		return errors.New("idempotency keys are assigned by the server")
+	}
+	return ValidRequest(request)
+}
+
+type EnqueueSagaResponse struct {
+	ID int `json:"id"`
+}
+
+type Saga struct {
+	ID        int        `json:"id"`
+	State     string     `json:"state"`
+	Steps     []SagaStep `json:"steps"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+type SagaStep struct {
+	Position                  int    `json:"position"`
+	State                     string `json:"state"`
+	ForwardTransactionID      *int   `json:"forward_transaction_id,omitempty"`
+	CompensationTransactionID *int   `json:"compensation_transaction_id,omitempty"`
+}
@@ -0,0 +1,81 @@
+package transaction
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// StatusSelector matches the outcome of a remote call. It is either a status code ("429"), a status class ("5xx"),
+// an inclusive status range ("500-504"), or one of NetworkErrorSelector and TimeoutSelector. In JSON, status codes
+// may also be given as numbers, e.g. [429, "5xx"].
+type StatusSelector string
+
+const (
+	NetworkErrorSelector StatusSelector = "network_error"
+	TimeoutSelector      StatusSelector = "timeout"
+)
+
+func (s *StatusSelector) UnmarshalJSON(data []byte) error {
+	var code int
+	if err := json.Unmarshal(data, &code); err == nil {
+		*s = StatusSelector(strconv.Itoa(code))
+		return nil
+	}
+
+	var selector string
+	if err := json.Unmarshal(data, &selector); err != nil {
+		return fmt.Errorf("status selector must be a number or a string: %w", err)
+	}
+	*s = StatusSelector(selector)
+	return nil
+}
+
+// StatusRange returns the inclusive range of status codes matched by the selector. It returns an error for
+// NetworkErrorSelector and TimeoutSelector, which do not match any status code.
+func (s StatusSelector) StatusRange() (low int, high int, err error) {
+	selector := strings.ToLower(strings.TrimSpace(string(s)))
+
+	if class, ok := strings.CutSuffix(selector, "xx"); ok {
+		digit, err := strconv.Atoi(class)
+		if err != nil || digit < 1 || digit > 5 {
+			return 0, 0, fmt.Errorf("status class %s is invalid", s)
+		}
+		return digit * 100, digit*100 + 99, nil
+	}
+
+	if from, to, ok := strings.Cut(selector, "-"); ok {
+		low, lowErr := parseStatusCode(from)
+		high, highErr := parseStatusCode(to)
+		if lowErr != nil || highErr != nil || low > high {
+			return 0, 0, fmt.Errorf("status range %s is invalid", s)
+		}
+		return low, high, nil
+	}
+
+	code, err := parseStatusCode(selector)
+	if err != nil {
+		return 0, 0, fmt.Errorf("status selector %s is invalid", s)
+	}
+	return code, code, nil
+}
+
+func (s StatusSelector) Validate() error {
+	if s == NetworkErrorSelector || s == TimeoutSelector {
+		return nil
+	}
+	_, _, err := s.StatusRange()
+	return err
+}
+
+func parseStatusCode(value string) (int, error) {
+	code, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, err
+	}
+	if code < 100 || code > 599 {
+		return 0, fmt.Errorf("status code %d is out of range", code)
+	}
+	return code, nil
+}
@@ -0,0 +1,92 @@
+package transaction
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+)
+
+func TestStatusRange(t *testing.T) {
+	tests := []struct {
+		name     string
+		selector StatusSelector
+		low      int
+		high     int
+		wantErr  bool
+	}{
+		{name: "status code", selector: "429", low: 429, high: 429},
+		{name: "status class", selector: "5xx", low: 500, high: 599},
+		{name: "upper case status class", selector: "4XX", low: 400, high: 499},
+		{name: "status class with spaces", selector: " 2xx ", low: 200, high: 299},
+		{name: "status range", selector: "500-504", low: 500, high: 504},
+		{name: "single code range", selector: "503-503", low: 503, high: 503},
+		{name: "status code out of range", selector: "600", wantErr: true},
+		{name: "status code below range", selector: "99", wantErr: true},
+		{name: "unknown status class", selector: "6xx", wantErr: true},
+		{name: "zero status class", selector: "0xx", wantErr: true},
+		{name: "reversed range", selector: "504-500", wantErr: true},
+		{name: "open range", selector: "500-", wantErr: true},
+		{name: "range out of bounds", selector: "500-600", wantErr: true},
+		{name: "network error", selector: NetworkErrorSelector, wantErr: true},
+		{name: "timeout", selector: TimeoutSelector, wantErr: true},
+		{name: "empty", selector: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			low, high, err := tt.selector.StatusRange()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("StatusRange() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if low != tt.low || high != tt.high {
+				t.Errorf("StatusRange() = (%d, %d), want (%d, %d)", low, high, tt.low, tt.high)
+			}
+		})
+	}
+}
+
+func TestStatusSelectorValidate(t *testing.T) {
+	tests := []struct {
+		selector StatusSelector
+		wantErr  bool
+	}{
+		{selector: NetworkErrorSelector},
+		{selector: TimeoutSelector},
+		{selector: "5xx"},
+		{selector: "connection_reset", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.selector), func(t *testing.T) {
+			if err := tt.selector.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestStatusSelectorUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    []StatusSelector
+		wantErr bool
+	}{
+		{name: "numbers and strings", data: `[429, "5xx", "timeout"]`, want: []StatusSelector{"429", "5xx", "timeout"}},
+		{name: "empty", data: `[]`, want: []StatusSelector{}},
+		{name: "object", data: `[{"code": 429}]`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []StatusSelector
+			err := json.Unmarshal([]byte(tt.data), &got)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Unmarshal() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !slices.Equal(got, tt.want) {
+				t.Errorf("Unmarshal() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
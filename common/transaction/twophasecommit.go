@@ -0,0 +1,62 @@
+package transaction
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+type EnqueueTwoPhaseCommitRequest struct {
+	Participants []TwoPhaseCommitParticipantRequest `json:"participants"`
+}
+
+// TwoPhaseCommitParticipantRequest holds the calls of a participant. Prepare is sent to every participant first, then
+// either Commit or Abort, depending on whether all of them have answered the prepare call with a 2xx status.
+type TwoPhaseCommitParticipantRequest struct {
+	Prepare EnqueueTransactionRequest `json:"prepare"`
+	Commit  EnqueueTransactionRequest `json:"commit"`
+	Abort   EnqueueTransactionRequest `json:"abort"`
+}
+
+func ValidTwoPhaseCommitRequest(request EnqueueTwoPhaseCommitRequest) error {
+	var errs []error
+	if len(request.Participants) == 0 {
+		errs = append(errs, errors.New("two-phase commit must have at least one participant"))
+	}
+	for i, participant := range request.Participants {
+		if err := validCoordinatedCall(participant.Prepare); err != nil {
+			errs = append(errs, fmt.Errorf("participant %d prepare: %w", i, err))
+		}
+		if err := validCoordinatedCall(participant.Commit); err != nil {
+			errs = append(errs, fmt.Errorf("participant %d commit: %w", i, err))
+		}
+		if err := validCoordinatedCall(participant.Abort); err != nil {
+			errs = append(errs, fmt.Errorf("participant %d abort: %w", i, err))
+		}
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+	return nil
+}
+
+type EnqueueTwoPhaseCommitResponse struct {
+	ID int `json:"id"`
+}
+
+type TwoPhaseCommit struct {
+	ID           int                         `json:"id"`
+	State        string                      `json:"state"`
+	Decision     string                      `json:"decision,omitempty"`
+	DecidedAt    *time.Time                  `json:"decided_at,omitempty"`
+	Participants []TwoPhaseCommitParticipant `json:"participants"`
+	CreatedAt    time.Time                   `json:"created_at"`
+	UpdatedAt    time.Time                   `json:"updated_at"`
+}
+
+type TwoPhaseCommitParticipant struct {
+	Position             int  `json:"position"`
+	PrepareTransactionID int  `json:"prepare_transaction_id"`
+	CommitTransactionID  *int `json:"commit_transaction_id,omitempty"`
+	AbortTransactionID   *int `json:"abort_transaction_id,omitempty"`
+}
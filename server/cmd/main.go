@@ -18,6 +18,8 @@ import (
 	"go.opentelemetry.io/contrib/bridges/otelslog"
 	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/prometheus"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
 )
 
 func main() {
@@ -30,7 +32,17 @@ func main() {
 		panic(err)
 	}
 
-	shutdown, err := setup.InitOTelSDK(ctx, collectorConfig.CollectorHost, serviceName)
+	var readers []sdkmetric.Reader
+	if collectorConfig.PrometheusMetrics {
+		exporter, err := prometheus.New()
+		if err != nil {
+			slog.Error("Failed to initialize the prometheus exporter", "err", err)
+			panic(err)
+		}
+		readers = append(readers, exporter)
+	}
+
+	shutdown, err := setup.InitOTelSDK(ctx, collectorConfig.CollectorHost, serviceName, readers...)
 	if err != nil {
 		slog.Error("Failed to initialize otel SDK", "err", err)
 		panic(err)
@@ -60,10 +72,26 @@ func main() {
 	}
 	defer logging.LoggedClose(pool)
 
-	repository := transaction.NewSQLRepository(pool)
+	repository, err := transaction.NewSQLRepository(pool, meter)
+	if err != nil {
+		slog.Error("Failed to initialize the repository", "err", err)
+		panic(err)
+	}
+
+	tlsConfig, err := config.NewTLSConfig(ctx)
+	if err != nil {
+		slog.Error("Failed to initialize the TLS config", "err", err)
+		panic(err)
+	}
+
+	transport, err := transaction.NewRemoteTransport(tlsConfig)
+	if err != nil {
+		slog.Error("Failed to initialize the remote transport", "err", err)
+		panic(err)
+	}
 
 	client := &http.Client{
-		Transport: otelhttp.NewTransport(http.DefaultTransport),
+		Transport: otelhttp.NewTransport(transport),
 	}
 
 	executorConfig, err := config.NewExecutorConfig(ctx)
@@ -72,10 +100,31 @@ func main() {
 		panic(err)
 	}
 
+	breakers := transaction.NewCircuitBreakers(executorConfig)
+
+	rateLimitsConfig, err := config.NewRateLimitsConfig(ctx)
+	if err != nil {
+		slog.Error("Failed to initialize the rate limits config", "err", err)
+		panic(err)
+	}
+
+	limiters, err := transaction.NewHostLimiters(rateLimitsConfig, repository)
+	if err != nil {
+		slog.Error("Failed to initialize the host limiters", "err", err)
+		panic(err)
+	}
+
+	listener := transaction.NewListener(databaseConfig.URL, executorConfig.ExecuteTransactionInterval)
+
+	executor, err := transaction.NewExecutor(tracer, meter, repository, client, breakers, limiters, listener, executorConfig)
+	if err != nil {
+		slog.Error("Failed to initialize the executor", "err", err)
+		panic(err)
+	}
+
 	go func() {
 		slog.Info("starting the executor", "config", executorConfig)
-		e := transaction.NewExecutor(tracer, meter, repository, client, executorConfig)
-		e.Start(ctx)
+		executor.Start(ctx)
 	}()
 
 	serverConfig, err := config.NewServer(ctx)
@@ -84,7 +133,7 @@ func main() {
 		panic(err)
 	}
 
-	handler := server.NewHandler(tracer, repository)
+	handler := server.NewHandler(tracer, repository, breakers, collectorConfig.PrometheusMetrics)
 	srv := server.NewServer(ctx, serverConfig, handler)
 
 	serverErrCh := make(chan error)
@@ -2,15 +2,40 @@ package config
 
 import (
 	"context"
+	"errors"
 	"github.com/sethvargo/go-envconfig"
 	"time"
 )
 
 type Executor struct {
-	ExecuteTransactionInterval time.Duration `env:"SERVER_EXECUTOR_TRANSACTION_INTERVAL, default=1s"`
-	WorkerAmount               int           `env:"SERVER_EXECUTOR_WORKER_AMOUNT, default=2"`
-	BatchSize                  int           `env:"SERVER_EXECUTOR_BATCH_SIZE, default=400"`
-	SenderAmount               int           `env:"SERVER_EXECUTOR_SENDER_AMOUNT, default=2"`
+	ExecuteTransactionInterval  time.Duration `env:"SERVER_EXECUTOR_TRANSACTION_INTERVAL, default=1s"`
+	WorkerAmount                int           `env:"SERVER_EXECUTOR_WORKER_AMOUNT, default=2"`
+	BatchSize                   int           `env:"SERVER_EXECUTOR_BATCH_SIZE, default=400"`
+	SenderAmount                int           `env:"SERVER_EXECUTOR_SENDER_AMOUNT, default=2"`
+	MaxAttempts                 int           `env:"SERVER_EXECUTOR_MAX_ATTEMPTS, default=10"`
+	RetryBaseDelay              time.Duration `env:"SERVER_EXECUTOR_RETRY_BASE_DELAY, default=1s"`
+	RetryMaxDelay               time.Duration `env:"SERVER_EXECUTOR_RETRY_MAX_DELAY, default=5m"`
+	LeaseDuration               time.Duration `env:"SERVER_EXECUTOR_LEASE_DURATION, default=2m"`
+	RequestTimeout              time.Duration `env:"SERVER_EXECUTOR_REQUEST_TIMEOUT, default=30s"`
+	RetryOn                     []string      `env:"SERVER_EXECUTOR_RETRY_ON, default=429,5xx,network_error,timeout"`
+	FailOn                      []string      `env:"SERVER_EXECUTOR_FAIL_ON"`
+	RecordedResponseHeaders     []string      `env:"SERVER_EXECUTOR_RECORDED_RESPONSE_HEADERS, default=Content-Type,Retry-After,Location"`
+	MaxRecordedBodySize         int           `env:"SERVER_EXECUTOR_MAX_RECORDED_BODY_SIZE, default=4096"`
+	CoordinatorRecoveryInterval time.Duration `env:"SERVER_EXECUTOR_COORDINATOR_RECOVERY_INTERVAL, default=30s"`
+	SchedulerInterval           time.Duration `env:"SERVER_EXECUTOR_SCHEDULER_INTERVAL, default=1s"`
+	// ListenForTransactions wakes the workers up as soon as transactions become due, in which case the
+	// ExecuteTransactionInterval is only a fallback.
+	ListenForTransactions bool `env:"SERVER_EXECUTOR_LISTEN_FOR_TRANSACTIONS, default=true"`
+	// PriorityAgingInterval is how long a due transaction waits before its priority is raised by one.
+	PriorityAgingInterval time.Duration `env:"SERVER_EXECUTOR_PRIORITY_AGING_INTERVAL, default=30s"`
+	// The circuit of a host opens when at least CircuitBreakerFailureRate of at least CircuitBreakerMinRequests calls
+	// within a CircuitBreakerWindow have failed, and stays open for CircuitBreakerOpenDuration.
+	CircuitBreakerFailureRate  float64       `env:"SERVER_EXECUTOR_CIRCUIT_BREAKER_FAILURE_RATE, default=0.5"`
+	CircuitBreakerMinRequests  int           `env:"SERVER_EXECUTOR_CIRCUIT_BREAKER_MIN_REQUESTS, default=20"`
+	CircuitBreakerWindow       time.Duration `env:"SERVER_EXECUTOR_CIRCUIT_BREAKER_WINDOW, default=30s"`
+	CircuitBreakerOpenDuration time.Duration `env:"SERVER_EXECUTOR_CIRCUIT_BREAKER_OPEN_DURATION, default=30s"`
+	// QueueMetricsInterval is how often the depth of the queue is counted for the metrics.
+	QueueMetricsInterval time.Duration `env:"SERVER_EXECUTOR_QUEUE_METRICS_INTERVAL, default=15s"`
 }
 
 func NewExecutorConfig(ctx context.Context) (Executor, error) {
@@ -18,6 +43,9 @@ func NewExecutorConfig(ctx context.Context) (Executor, error) {
 	if err := envconfig.Process(ctx, &config); err != nil {
 		return config, err
 	}
+	if config.PriorityAgingInterval <= 0 {
+		return config, errors.New("priority aging interval must be positive")
+	}
 
 	return config, nil
 }
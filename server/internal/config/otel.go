@@ -7,6 +7,9 @@ import (
 
 type Collector struct {
 	CollectorHost string `env:"OTEL_COLLECTOR_HOST, default=localhost:4317"`
+	// PrometheusMetrics exposes the metrics on the /metrics endpoint of the server as well, to be scraped without the
+	// collector.
+	PrometheusMetrics bool `env:"SERVER_PROMETHEUS_METRICS, default=false"`
 }
 
 func NewCollectorConfig(ctx context.Context) (Collector, error) {
@@ -0,0 +1,64 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"github.com/sethvargo/go-envconfig"
+	"strings"
+	"time"
+)
+
+// RateLimits configures how hard the executor calls the remote hosts. Default applies to each host separately, unless
+// the host is listed in one of the named profiles, e.g. SERVER_RATE_LIMIT_PROFILES=partner with
+// SERVER_RATE_LIMIT_PROFILE_PARTNER_HOSTS and SERVER_RATE_LIMIT_PROFILE_PARTNER_REQUESTS_PER_SECOND. Zero limits are
+// not enforced.
+//
+// When Coordinated is set, the requests per second of a host are shared by all the replicas through Postgres, while
+// the in-flight cap still applies to each replica separately.
+type RateLimits struct {
+	Default      RateLimit     `env:", prefix=SERVER_RATE_LIMIT_"`
+	Coordinated  bool          `env:"SERVER_RATE_LIMIT_COORDINATED, default=false"`
+	MaxWait      time.Duration `env:"SERVER_RATE_LIMIT_MAX_WAIT, default=1s"`
+	ProfileNames []string      `env:"SERVER_RATE_LIMIT_PROFILES"`
+	Profiles     map[string]RateLimit
+}
+
+type RateLimit struct {
+	Hosts             []string `env:"HOSTS"`
+	RequestsPerSecond float64  `env:"REQUESTS_PER_SECOND"`
+	Burst             int      `env:"BURST"`
+	MaxInFlight       int      `env:"MAX_IN_FLIGHT"`
+}
+
+func NewRateLimitsConfig(ctx context.Context) (RateLimits, error) {
+	var config RateLimits
+	if err := envconfig.Process(ctx, &config); err != nil {
+		return RateLimits{}, err
+	}
+
+	config.Profiles = make(map[string]RateLimit, len(config.ProfileNames))
+	for _, name := range config.ProfileNames {
+		var profile RateLimit
+		prefix := fmt.Sprintf("SERVER_RATE_LIMIT_PROFILE_%s_", strings.ToUpper(name))
+		if err := envconfig.ProcessWith(ctx, &envconfig.Config{
+			Target:   &profile,
+			Lookuper: envconfig.PrefixLookuper(prefix, envconfig.OsLookuper()),
+		}); err != nil {
+			return RateLimits{}, err
+		}
+		if len(profile.Hosts) == 0 {
+			return RateLimits{}, fmt.Errorf("rate limit profile %s has no hosts", name)
+		}
+		config.Profiles[name] = profile
+	}
+
+	return config, nil
+}
+
+// BurstOrDefault allows a second worth of requests at once, unless the burst is configured.
+func (l RateLimit) BurstOrDefault() int {
+	if l.Burst > 0 {
+		return l.Burst
+	}
+	return max(int(l.RequestsPerSecond), 1)
+}
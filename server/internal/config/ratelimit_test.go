@@ -0,0 +1,54 @@
+package config
+
+import (
+	"context"
+	"testing"
+)
+
+func TestBurstOrDefault(t *testing.T) {
+	tests := []struct {
+		name  string
+		limit RateLimit
+		want  int
+	}{
+		{name: "configured burst", limit: RateLimit{RequestsPerSecond: 10, Burst: 3}, want: 3},
+		{name: "a second worth of requests", limit: RateLimit{RequestsPerSecond: 10}, want: 10},
+		{name: "fractional rate", limit: RateLimit{RequestsPerSecond: 0.5}, want: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.limit.BurstOrDefault(); got != tt.want {
+				t.Errorf("BurstOrDefault() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewRateLimitsConfig(t *testing.T) {
+	t.Setenv("SERVER_RATE_LIMIT_REQUESTS_PER_SECOND", "5")
+	t.Setenv("SERVER_RATE_LIMIT_PROFILES", "partner")
+	t.Setenv("SERVER_RATE_LIMIT_PROFILE_PARTNER_HOSTS", "a.example.com,b.example.com:8443")
+	t.Setenv("SERVER_RATE_LIMIT_PROFILE_PARTNER_MAX_IN_FLIGHT", "2")
+
+	config, err := NewRateLimitsConfig(context.Background())
+	if err != nil {
+		t.Fatalf("NewRateLimitsConfig() error = %v", err)
+	}
+	if config.Default.RequestsPerSecond != 5 {
+		t.Errorf("NewRateLimitsConfig() default requests per second = %v, want 5", config.Default.RequestsPerSecond)
+	}
+	partner := config.Profiles["partner"]
+	if len(partner.Hosts) != 2 || partner.MaxInFlight != 2 || partner.RequestsPerSecond != 0 {
+		t.Errorf("NewRateLimitsConfig() partner profile = %+v", partner)
+	}
+}
+
+func TestNewRateLimitsConfigRejectsProfileWithoutHosts(t *testing.T) {
+	t.Setenv("SERVER_RATE_LIMIT_PROFILES", "partner")
+	t.Setenv("SERVER_RATE_LIMIT_PROFILE_PARTNER_MAX_IN_FLIGHT", "2")
+
+	if _, err := NewRateLimitsConfig(context.Background()); err == nil {
+		t.Error("NewRateLimitsConfig() error = nil, want the profile without hosts rejected")
+	}
+}
@@ -0,0 +1,108 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/sethvargo/go-envconfig"
+	"os"
+	"strings"
+)
+
+// TLS configures the outbound calls made by the executor. Default applies to every host, unless the host is listed in
+// one of the named profiles, e.g. SERVER_TLS_PROFILES=payments with SERVER_TLS_PROFILE_PAYMENTS_HOSTS and
+// SERVER_TLS_PROFILE_PAYMENTS_CA_FILE. Files left empty in a profile are taken from Default, while the server name
+// can only be set per profile, since it names the certificate of particular hosts.
+type TLS struct {
+	Default      TLSDefault `env:", prefix=SERVER_TLS_"`
+	ProfileNames []string   `env:"SERVER_TLS_PROFILES"`
+	Profiles     map[string]TLSProfile
+}
+
+type TLSDefault struct {
+	CAFile   string `env:"CA_FILE"`
+	CertFile string `env:"CERT_FILE"`
+	KeyFile  string `env:"KEY_FILE"`
+}
+
+type TLSProfile struct {
+	Hosts      []string `env:"HOSTS"`
+	CAFile     string   `env:"CA_FILE"`
+	CertFile   string   `env:"CERT_FILE"`
+	KeyFile    string   `env:"KEY_FILE"`
+	ServerName string   `env:"SERVER_NAME"`
+}
+
+// unsupportedTLSVariables used to configure the default profile, and are rejected rather than ignored.
+var unsupportedTLSVariables = []string{"SERVER_TLS_HOSTS", "SERVER_TLS_SERVER_NAME"}
+
+func NewTLSConfig(ctx context.Context) (TLS, error) {
+	for _, name := range unsupportedTLSVariables {
+		if _, ok := os.LookupEnv(name); ok {
+			return TLS{}, fmt.Errorf("%s is not supported, set it in a TLS profile instead", name)
+		}
+	}
+
+	var config TLS
+	if err := envconfig.Process(ctx, &config); err != nil {
+		return TLS{}, err
+	}
+	if err := validClientCertificate(config.Default.CertFile, config.Default.KeyFile); err != nil {
+		return TLS{}, fmt.Errorf("default TLS profile: %w", err)
+	}
+
+	config.Profiles = make(map[string]TLSProfile, len(config.ProfileNames))
+	profileHosts := make(map[string]string)
+	for _, name := range config.ProfileNames {
+		var profile TLSProfile
+		prefix := fmt.Sprintf("SERVER_TLS_PROFILE_%s_", strings.ToUpper(name))
+		if err := envconfig.ProcessWith(ctx, &envconfig.Config{
+			Target:   &profile,
+			Lookuper: envconfig.PrefixLookuper(prefix, envconfig.OsLookuper()),
+		}); err != nil {
+			return TLS{}, err
+		}
+		if len(profile.Hosts) == 0 {
+			return TLS{}, fmt.Errorf("TLS profile %s has no hosts", name)
+		}
+		for _, host := range profile.Hosts {
+			if other, ok := profileHosts[host]; ok {
+				return TLS{}, fmt.Errorf("host %s belongs to both the %s and the %s TLS profiles", host, other, name)
+			}
+			profileHosts[host] = name
+		}
+		if err := validClientCertificate(profile.CertFile, profile.KeyFile); err != nil {
+			return TLS{}, fmt.Errorf("TLS profile %s: %w", name, err)
+		}
+		config.Profiles[name] = profile.withDefaults(config.Default)
+	}
+
+	return config, nil
+}
+
+func validClientCertificate(certFile string, keyFile string) error {
+	if (certFile == "") != (keyFile == "") {
+		return errors.New("client certificate and key must be configured together")
+	}
+	return nil
+}
+
+func (p TLSProfile) withDefaults(defaults TLSDefault) TLSProfile {
+	if p.CAFile == "" {
+		p.CAFile = defaults.CAFile
+	}
+	if p.CertFile == "" && p.KeyFile == "" {
+		p.CertFile = defaults.CertFile
+		p.KeyFile = defaults.KeyFile
+	}
+	return p
+}
+
+// Profile returns the default as a profile which applies to no host in particular.
+func (d TLSDefault) Profile() TLSProfile {
+	return TLSProfile{
+		CAFile:   d.CAFile,
+		CertFile: d.CertFile,
+		KeyFile:  d.KeyFile,
+	}
+}
@@ -0,0 +1,83 @@
+package config
+
+import (
+	"context"
+	"testing"
+)
+
+func TestNewTLSConfig(t *testing.T) {
+	t.Setenv("SERVER_TLS_CA_FILE", "/etc/ssl/internal-ca.pem")
+	t.Setenv("SERVER_TLS_PROFILES", "payments,ledger")
+	t.Setenv("SERVER_TLS_PROFILE_PAYMENTS_HOSTS", "payments.example.com")
+	t.Setenv("SERVER_TLS_PROFILE_PAYMENTS_SERVER_NAME", "payments.internal")
+	t.Setenv("SERVER_TLS_PROFILE_LEDGER_HOSTS", "ledger.example.com:8443")
+	t.Setenv("SERVER_TLS_PROFILE_LEDGER_CA_FILE", "/etc/ssl/ledger-ca.pem")
+
+	config, err := NewTLSConfig(context.Background())
+	if err != nil {
+		t.Fatalf("NewTLSConfig() error = %v", err)
+	}
+
+	payments := config.Profiles["payments"]
+	if payments.CAFile != "/etc/ssl/internal-ca.pem" || payments.ServerName != "payments.internal" {
+		t.Errorf("NewTLSConfig() payments profile = %+v, want the default CA file and its own server name", payments)
+	}
+	ledger := config.Profiles["ledger"]
+	if ledger.CAFile != "/etc/ssl/ledger-ca.pem" || ledger.ServerName != "" {
+		t.Errorf("NewTLSConfig() ledger profile = %+v, want its own CA file and no server name", ledger)
+	}
+}
+
+func TestNewTLSConfigRejectsInvalidConfiguration(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+	}{
+		{
+			name: "default server name",
+			env:  map[string]string{"SERVER_TLS_SERVER_NAME": "payments.internal"},
+		},
+		{
+			name: "default hosts",
+			env:  map[string]string{"SERVER_TLS_HOSTS": "payments.example.com"},
+		},
+		{
+			name: "default certificate without a key",
+			env:  map[string]string{"SERVER_TLS_CERT_FILE": "/etc/ssl/client.pem"},
+		},
+		{
+			name: "profile without hosts",
+			env: map[string]string{
+				"SERVER_TLS_PROFILES":                 "payments",
+				"SERVER_TLS_PROFILE_PAYMENTS_CA_FILE": "/etc/ssl/payments-ca.pem",
+			},
+		},
+		{
+			name: "profile key without a certificate",
+			env: map[string]string{
+				"SERVER_TLS_PROFILES":                  "payments",
+				"SERVER_TLS_PROFILE_PAYMENTS_HOSTS":    "payments.example.com",
+				"SERVER_TLS_PROFILE_PAYMENTS_KEY_FILE": "/etc/ssl/client-key.pem",
+			},
+		},
+		{
+			name: "host in two profiles",
+			env: map[string]string{
+				"SERVER_TLS_PROFILES":               "payments,ledger",
+				"SERVER_TLS_PROFILE_PAYMENTS_HOSTS": "shared.example.com",
+				"SERVER_TLS_PROFILE_LEDGER_HOSTS":   "shared.example.com",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+			if _, err := NewTLSConfig(context.Background()); err == nil {
+				t.Error("NewTLSConfig() error = nil, want the configuration rejected")
+			}
+		})
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"github.com/mat-sik/sql-distributed-transactions/server/internal/config"
 	"github.com/mat-sik/sql-distributed-transactions/server/internal/transaction"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 	"go.opentelemetry.io/otel/trace"
 	"net"
@@ -23,7 +24,12 @@ func NewServer(ctx context.Context, serverConfig config.Server, handler http.Han
 	}
 }
 
-func NewHandler(tracer trace.Tracer, repository transaction.Repository) http.Handler {
+func NewHandler(
+	tracer trace.Tracer,
+	repository transaction.Repository,
+	breakers *transaction.CircuitBreakers,
+	prometheusMetrics bool,
+) http.Handler {
 	mux := http.NewServeMux()
 
 	handleFunc := func(pattern string, handler http.Handler) {
@@ -31,9 +37,29 @@ func NewHandler(tracer trace.Tracer, repository transaction.Repository) http.Han
 		mux.Handle(pattern, handler)
 	}
 
-	transactionHandler := transaction.NewHandler(tracer, repository)
-
-	handleFunc("POST /transactions/enqueue", transactionHandler)
+	handleFunc("POST /transactions/enqueue", transaction.NewEnqueueHandler(tracer, repository))
+	handleFunc("POST /transactions/enqueue:batch", transaction.NewEnqueueBatchHandler(tracer, repository))
+	handleFunc("GET /transactions", transaction.NewListHandler(tracer, repository))
+	handleFunc("GET /transactions/counts", transaction.NewCountHandler(tracer, repository))
+	handleFunc("GET /transactions/{id}", transaction.NewGetHandler(tracer, repository))
+	handleFunc("GET /transactions/failed", transaction.NewListFailedHandler(tracer, repository))
+	handleFunc("POST /transactions/{id}/requeue", transaction.NewRequeueHandler(tracer, repository))
+	handleFunc("POST /transactions/{id}/cancel", transaction.NewCancelHandler(tracer, repository))
+	handleFunc("GET /transactions/{id}/attempts", transaction.NewListAttemptsHandler(tracer, repository))
+	handleFunc("POST /admin/transactions/replay", transaction.NewReplayHandler(tracer, repository))
+	handleFunc("GET /admin/circuit-breakers", transaction.NewListCircuitBreakersHandler(tracer, breakers))
+	handleFunc("POST /sagas", transaction.NewEnqueueSagaHandler(tracer, repository))
+	handleFunc("GET /sagas/{id}", transaction.NewGetSagaHandler(tracer, repository))
+	handleFunc("POST /two-phase-commits", transaction.NewEnqueueTwoPhaseCommitHandler(tracer, repository))
+	handleFunc("GET /two-phase-commits/{id}", transaction.NewGetTwoPhaseCommitHandler(tracer, repository))
+	handleFunc("POST /recurring-transactions", transaction.NewCreateRecurringHandler(tracer, repository))
+	handleFunc("GET /recurring-transactions", transaction.NewListRecurringHandler(tracer, repository))
+	handleFunc("GET /recurring-transactions/{id}", transaction.NewGetRecurringHandler(tracer, repository))
+	handleFunc("PUT /recurring-transactions/{id}", transaction.NewReplaceRecurringHandler(tracer, repository))
+	handleFunc("DELETE /recurring-transactions/{id}", transaction.NewDeleteRecurringHandler(tracer, repository))
+	if prometheusMetrics {
+		handleFunc("GET /metrics", promhttp.Handler())
+	}
 
 	handler := otelhttp.NewHandler(mux, "/")
 	return handler
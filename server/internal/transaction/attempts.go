@@ -0,0 +1,177 @@
+package transaction
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"github.com/mat-sik/sql-distributed-transactions/server/internal/logging"
+	"net/http"
+	"time"
+
+	commons "github.com/mat-sik/sql-distributed-transactions/common/transaction"
+)
+
+type transactionAttempt struct {
+	TransactionID   int
+	Attempt         int
+	StartedAt       time.Time
+	FinishedAt      time.Time
+	StatusCode      sql.NullInt32
+	ResponseHeaders sql.NullString
+	ResponseBody    sql.NullString
+	Error           sql.NullString
+}
+
+func newTransactionAttempt(
+	transactionID int,
+	startedAt time.Time,
+	finishedAt time.Time,
+	resp remoteResponse,
+	err error,
+	recordedHeaders []string,
+) transactionAttempt {
+	a := transactionAttempt{
+		TransactionID: transactionID,
+		StartedAt:     startedAt,
+		FinishedAt:    finishedAt,
+	}
+
+	if err == nil {
+		err = resp.BodyErr
+	}
+	if err != nil {
+		a.Error = sql.NullString{
+			String: err.Error(),
+			Valid:  true,
+		}
+	}
+
+	if resp.StatusCode == 0 {
+		return a
+	}
+
+	a.StatusCode = sql.NullInt32{
+		Int32: int32(resp.StatusCode),
+		Valid: true,
+	}
+	a.ResponseBody = sql.NullString{
+		String: resp.Body,
+		Valid:  true,
+	}
+	if headers := selectHeaders(resp.Header, recordedHeaders); len(headers) > 0 {
+		// Marshalling a map of strings cannot fail.
+		headersJSON, _ := json.Marshal(headers)
+		a.ResponseHeaders = sql.NullString{
+			String: string(headersJSON),
+			Valid:  true,
+		}
+	}
+	return a
+}
+
+func selectHeaders(header http.Header, names []string) map[string][]string {
+	selected := make(map[string][]string)
+	for _, name := range names {
+		name = http.CanonicalHeaderKey(name)
+		if values := header.Values(name); len(values) > 0 {
+			selected[name] = values
+		}
+	}
+	return selected
+}
+
+func (a transactionAttempt) toResponse() commons.TransactionAttempt {
+	resp := commons.TransactionAttempt{
+		Attempt:      a.Attempt,
+		StartedAt:    a.StartedAt,
+		FinishedAt:   a.FinishedAt,
+		ResponseBody: a.ResponseBody.String,
+		Error:        a.Error.String,
+	}
+	if a.StatusCode.Valid {
+		statusCode := int(a.StatusCode.Int32)
+		resp.StatusCode = &statusCode
+	}
+	if a.ResponseHeaders.Valid {
+		// The headers have been marshalled by the executor, so a failure here only drops them from the response.
+		_ = json.Unmarshal([]byte(a.ResponseHeaders.String), &resp.ResponseHeaders)
+	}
+	return resp
+}
+
+// insertTransactionAttempt numbers the attempt one above the last recorded one. The attempts counter of the transaction
+// is reset when it is requeued or replayed, so it cannot be used, as the numbers in the history would repeat.
+func (r SQLRepository) insertTransactionAttempt(ctx context.Context, tx *sql.Tx, attempt transactionAttempt) error {
+	query := `
+		INSERT INTO transaction_attempts (
+			transaction_id, attempt, started_at, finished_at, status_code, response_headers, response_body, error
+		) VALUES (
+			$1,
+			(SELECT coalesce(max(attempt), 0) + 1 FROM transaction_attempts WHERE transaction_id = $1),
+			$2, $3, $4, $5, $6, $7
+		)
+	`
+
+	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer logging.LoggedClose(stmt)
+
+	_, err = stmt.ExecContext(
+		ctx,
+		attempt.TransactionID,
+		attempt.StartedAt,
+		attempt.FinishedAt,
+		attempt.StatusCode,
+		attempt.ResponseHeaders,
+		attempt.ResponseBody,
+		attempt.Error,
+	)
+	return err
+}
+
+func (r SQLRepository) fetchTransactionAttempts(ctx context.Context, transactionID int) ([]transactionAttempt, error) {
+	query := `
+		SELECT transaction_id, attempt, started_at, finished_at, status_code, response_headers, response_body, error
+		FROM transaction_attempts
+		WHERE transaction_id = $1
+		ORDER BY id
+	`
+
+	stmt, err := r.pool.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer logging.LoggedClose(stmt)
+
+	rows, err := stmt.QueryContext(ctx, transactionID)
+	if err != nil {
+		return nil, err
+	}
+	defer logging.LoggedClose(rows)
+
+	var attempts []transactionAttempt
+	for rows.Next() {
+		var a transactionAttempt
+		if err = rows.Scan(
+			&a.TransactionID,
+			&a.Attempt,
+			&a.StartedAt,
+			&a.FinishedAt,
+			&a.StatusCode,
+			&a.ResponseHeaders,
+			&a.ResponseBody,
+			&a.Error,
+		); err != nil {
+			return nil, err
+		}
+		attempts = append(attempts, a)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return attempts, nil
+}
@@ -0,0 +1,163 @@
+package transaction
+
+import (
+	"cmp"
+	"github.com/mat-sik/sql-distributed-transactions/server/internal/config"
+	"slices"
+	"sync"
+	"time"
+
+	commons "github.com/mat-sik/sql-distributed-transactions/common/transaction"
+)
+
+type circuitState string
+
+const (
+	circuitClosed   circuitState = "closed"
+	circuitOpen     circuitState = "open"
+	circuitHalfOpen circuitState = "half_open"
+)
+
+// CircuitBreakers keeps a circuit breaker for each remote host, shared by all the workers of the process. A circuit
+// opens once the failure rate within a window reaches the threshold. After the open duration it lets a single probe
+// through, and closes again when the probe succeeds.
+type CircuitBreakers struct {
+	mu       sync.Mutex
+	breakers map[string]*circuitBreaker
+	config   config.Executor
+}
+
+type circuitBreaker struct {
+	state       circuitState
+	windowStart time.Time
+	requests    int
+	failures    int
+	openedAt    time.Time
+	probing     bool
+}
+
+func NewCircuitBreakers(config config.Executor) *CircuitBreakers {
+	return &CircuitBreakers{
+		breakers: make(map[string]*circuitBreaker),
+		config:   config,
+	}
+}
+
+// allow reports whether a call to the host can be made now. When it cannot, it returns how long to wait before trying
+// again.
+func (b *CircuitBreakers) allow(host string, now time.Time) (bool, time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	breaker := b.breaker(host, now)
+	if breaker.state == circuitOpen {
+		openUntil := breaker.openedAt.Add(b.config.CircuitBreakerOpenDuration)
+		if now.Before(openUntil) {
+			return false, openUntil.Sub(now)
+		}
+		breaker.state = circuitHalfOpen
+	}
+	if breaker.state == circuitHalfOpen {
+		if breaker.probing {
+			return false, b.config.ExecuteTransactionInterval
+		}
+		breaker.probing = true
+	}
+	return true, 0
+}
+
+// record accounts for the outcome of a call which has been allowed.
+func (b *CircuitBreakers) record(host string, failed bool, now time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	breaker := b.breaker(host, now)
+	switch breaker.state {
+	case circuitHalfOpen:
+		breaker.probing = false
+		if failed {
+			breaker.open(now)
+		} else {
+			breaker.close(now)
+		}
+	case circuitClosed:
+		if now.Sub(breaker.windowStart) >= b.config.CircuitBreakerWindow {
+			breaker.close(now)
+		}
+		breaker.requests++
+		if failed {
+			breaker.failures++
+		}
+		if breaker.requests >= b.config.CircuitBreakerMinRequests &&
+			float64(breaker.failures)/float64(breaker.requests) >= b.config.CircuitBreakerFailureRate {
+			breaker.open(now)
+		}
+	case circuitOpen:
+		// The call has been started before the circuit opened.
+	}
+}
+
+// abandon gives back a probe which has been allowed, but has not been made.
+func (b *CircuitBreakers) abandon(host string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if breaker, ok := b.breakers[host]; ok && breaker.state == circuitHalfOpen {
+		breaker.probing = false
+	}
+}
+
+func (b *CircuitBreakers) breaker(host string, now time.Time) *circuitBreaker {
+	breaker, ok := b.breakers[host]
+	if !ok {
+		breaker = &circuitBreaker{
+			state:       circuitClosed,
+			windowStart: now,
+		}
+		b.breakers[host] = breaker
+	}
+	return breaker
+}
+
+func (c *circuitBreaker) open(now time.Time) {
+	c.state = circuitOpen
+	c.openedAt = now
+}
+
+func (c *circuitBreaker) close(now time.Time) {
+	c.state = circuitClosed
+	c.windowStart = now
+	c.requests = 0
+	c.failures = 0
+}
+
+// snapshot returns the state of every circuit, ordered by host.
+func (b *CircuitBreakers) snapshot() []commons.CircuitBreaker {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	snapshot := make([]commons.CircuitBreaker, 0, len(b.breakers))
+	for host, breaker := range b.breakers {
+		status := commons.CircuitBreaker{
+			Host:     host,
+			State:    string(breaker.state),
+			Requests: breaker.requests,
+			Failures: breaker.failures,
+		}
+		if breaker.state != circuitClosed {
+			openedAt := breaker.openedAt
+			status.OpenedAt = &openedAt
+		}
+		snapshot = append(snapshot, status)
+	}
+	slices.SortFunc(snapshot, func(a, b commons.CircuitBreaker) int {
+		return cmp.Compare(a.Host, b.Host)
+	})
+	return snapshot
+}
+
+// callFailed reports whether the outcome of a call speaks against the health of the host, regardless of how the
+// transaction classifies it.
+func callFailed(result callResult) bool {
+	return result.Failure != "" || result.StatusCode >= 500
+}
@@ -0,0 +1,188 @@
+package transaction
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mat-sik/sql-distributed-transactions/server/internal/config"
+)
+
+type breakerCall int
+
+const (
+	callAllow breakerCall = iota
+	callRecord
+	callAbandon
+)
+
+type breakerStep struct {
+	at      time.Duration
+	call    breakerCall
+	failed  bool
+	allowed bool
+	wait    time.Duration
+	state   circuitState
+}
+
+func TestCircuitBreakers(t *testing.T) {
+	const host = "example.com"
+	start := time.Date(2025, 3, 10, 12, 30, 0, 0, time.UTC)
+	executorConfig := config.Executor{
+		ExecuteTransactionInterval: time.Second,
+		CircuitBreakerFailureRate:  0.5,
+		CircuitBreakerMinRequests:  4,
+		CircuitBreakerWindow:       time.Minute,
+		CircuitBreakerOpenDuration: 30 * time.Second,
+	}
+
+	allow := func(at time.Duration, allowed bool, wait time.Duration, state circuitState) breakerStep {
+		return breakerStep{at: at, call: callAllow, allowed: allowed, wait: wait, state: state}
+	}
+	record := func(at time.Duration, failed bool, state circuitState) breakerStep {
+		return breakerStep{at: at, call: callRecord, failed: failed, state: state}
+	}
+	abandon := func(at time.Duration, state circuitState) breakerStep {
+		return breakerStep{at: at, call: callAbandon, state: state}
+	}
+	// opened fails enough calls to open the circuit at the start, and then takes the steps.
+	opened := func(steps ...breakerStep) []breakerStep {
+		return append([]breakerStep{
+			record(0, true, circuitClosed),
+			record(0, true, circuitClosed),
+			record(0, true, circuitClosed),
+			record(0, true, circuitOpen),
+		}, steps...)
+	}
+
+	tests := []struct {
+		name  string
+		steps []breakerStep
+	}{
+		{
+			name: "stays closed below the minimum requests",
+			steps: []breakerStep{
+				record(0, true, circuitClosed),
+				record(0, true, circuitClosed),
+				record(0, true, circuitClosed),
+				allow(0, true, 0, circuitClosed),
+			},
+		},
+		{
+			name: "stays closed below the failure rate",
+			steps: []breakerStep{
+				record(0, false, circuitClosed),
+				record(0, false, circuitClosed),
+				record(0, false, circuitClosed),
+				record(0, true, circuitClosed),
+				record(0, false, circuitClosed),
+			},
+		},
+		{
+			name: "opens at the failure rate",
+			steps: []breakerStep{
+				record(0, false, circuitClosed),
+				record(0, true, circuitClosed),
+				record(0, false, circuitClosed),
+				record(0, true, circuitOpen),
+				allow(10*time.Second, false, 20*time.Second, circuitOpen),
+			},
+		},
+		{
+			name: "restarts the counts with a new window",
+			steps: []breakerStep{
+				record(0, true, circuitClosed),
+				record(0, true, circuitClosed),
+				record(0, true, circuitClosed),
+				record(time.Minute, true, circuitClosed),
+				record(time.Minute, true, circuitClosed),
+				record(time.Minute, true, circuitClosed),
+				record(time.Minute, true, circuitOpen),
+			},
+		},
+		{
+			name: "ignores the calls started before the circuit opened",
+			steps: opened(
+				record(time.Second, false, circuitOpen),
+				allow(time.Second, false, 29*time.Second, circuitOpen),
+			),
+		},
+		{
+			name: "lets a single probe through after the open duration",
+			steps: opened(
+				allow(30*time.Second, true, 0, circuitHalfOpen),
+				allow(30*time.Second, false, time.Second, circuitHalfOpen),
+			),
+		},
+		{
+			name: "closes when the probe succeeds",
+			steps: opened(
+				allow(30*time.Second, true, 0, circuitHalfOpen),
+				record(31*time.Second, false, circuitClosed),
+				allow(31*time.Second, true, 0, circuitClosed),
+				record(31*time.Second, true, circuitClosed),
+			),
+		},
+		{
+			name: "opens again when the probe fails",
+			steps: opened(
+				allow(30*time.Second, true, 0, circuitHalfOpen),
+				record(31*time.Second, true, circuitOpen),
+				allow(60*time.Second, false, time.Second, circuitOpen),
+				allow(61*time.Second, true, 0, circuitHalfOpen),
+			),
+		},
+		{
+			name: "lets another probe through when the probe is abandoned",
+			steps: opened(
+				allow(30*time.Second, true, 0, circuitHalfOpen),
+				abandon(30*time.Second, circuitHalfOpen),
+				allow(30*time.Second, true, 0, circuitHalfOpen),
+			),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			breakers := NewCircuitBreakers(executorConfig)
+			for i, step := range tt.steps {
+				now := start.Add(step.at)
+				switch step.call {
+				case callAllow:
+					allowed, wait := breakers.allow(host, now)
+					if allowed != step.allowed || wait != step.wait {
+						t.Fatalf("step %d: allow() = (%v, %v), want (%v, %v)", i, allowed, wait, step.allowed, step.wait)
+					}
+				case callRecord:
+					breakers.record(host, step.failed, now)
+				case callAbandon:
+					breakers.abandon(host)
+				}
+				if state := breakers.breakers[host].state; state != step.state {
+					t.Fatalf("step %d: state = %q, want %q", i, state, step.state)
+				}
+			}
+		})
+	}
+}
+
+func TestCallFailed(t *testing.T) {
+	tests := []struct {
+		name   string
+		result callResult
+		want   bool
+	}{
+		{name: "success", result: callResult{StatusCode: 200}, want: false},
+		{name: "client error", result: callResult{StatusCode: 429}, want: false},
+		{name: "server error", result: callResult{StatusCode: 503}, want: true},
+		{name: "network error", result: callResult{Failure: "network_error"}, want: true},
+		{name: "timeout", result: callResult{Failure: "timeout"}, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := callFailed(tt.result); got != tt.want {
+				t.Errorf("callFailed() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package transaction
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	commons "github.com/mat-sik/sql-distributed-transactions/common/transaction"
+)
+
+// responseClassifier decides what happens to a transaction after a remote call. Outcomes matching failOn are
+// dead-lettered right away, outcomes matching retryOn are retried, and everything else marks the transaction as done.
+type responseClassifier struct {
+	retryOn []commons.StatusSelector
+	failOn  []commons.StatusSelector
+}
+
+func newResponseClassifier(retryOn []string, failOn []string) (responseClassifier, error) {
+	c := responseClassifier{
+		retryOn: toStatusSelectors(retryOn),
+		failOn:  toStatusSelectors(failOn),
+	}
+	for _, selector := range slices.Concat(c.retryOn, c.failOn) {
+		if err := selector.Validate(); err != nil {
+			return responseClassifier{}, err
+		}
+	}
+	return c, nil
+}
+
+func toStatusSelectors(values []string) []commons.StatusSelector {
+	selectors := make([]commons.StatusSelector, 0, len(values))
+	for _, value := range values {
+		selectors = append(selectors, commons.StatusSelector(value))
+	}
+	return selectors
+}
+
+// withPolicy returns the classifier with its lists replaced by the ones the transaction was enqueued with.
+func (c responseClassifier) withPolicy(policy responsePolicy) responseClassifier {
+	if policy.RetryOn != nil {
+		c.retryOn = policy.RetryOn
+	}
+	if policy.FailOn != nil {
+		c.failOn = policy.FailOn
+	}
+	return c
+}
+
+func (c responseClassifier) classify(result callResult) state {
+	if matchesAny(c.failOn, result) {
+		return FAILED
+	}
+	if matchesAny(c.retryOn, result) {
+		return RETRY
+	}
+	return DONE
+}
+
+func matchesAny(selectors []commons.StatusSelector, result callResult) bool {
+	for _, selector := range selectors {
+		if result.Failure != "" {
+			if selector == result.Failure {
+				return true
+			}
+			continue
+		}
+
+		low, high, err := selector.StatusRange()
+		if err == nil && low <= result.StatusCode && result.StatusCode <= high {
+			return true
+		}
+	}
+	return false
+}
+
+// callResult is the outcome of a remote call, either a response status code, or a failure when no response has been
+// received.
+type callResult struct {
+	StatusCode int
+	Failure    commons.StatusSelector
+	RetryAfter time.Duration
+}
+
+func newCallResult(resp remoteResponse, err error) callResult {
+	if err != nil {
+		var netErr net.Error
+		if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+			return callResult{Failure: commons.TimeoutSelector}
+		}
+		return callResult{Failure: commons.NetworkErrorSelector}
+	}
+
+	result := callResult{StatusCode: resp.StatusCode}
+	// Retry-After is only defined as a retry hint for 429 and 503. Other statuses, such as a 500 sent by a proxy which
+	// copies the header of the upstream, should not hold the transaction back.
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+		result.RetryAfter = parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+	}
+	return result
+}
+
+// parseRetryAfter reads the Retry-After header, which holds either a number of seconds or an HTTP date.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return max(time.Duration(seconds)*time.Second, 0)
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(date.Sub(now), 0)
+	}
+	return 0
+}
+
+// responsePolicy is the per transaction override of the responseClassifier, stored as JSON with the transaction.
+// A nil list means that the server-wide list applies.
+type responsePolicy struct {
+	RetryOn []commons.StatusSelector `json:"retry_on"`
+	FailOn  []commons.StatusSelector `json:"fail_on"`
+}
+
+func parseResponsePolicy(policyJSON string) (responsePolicy, error) {
+	var policy responsePolicy
+	if err := json.Unmarshal([]byte(policyJSON), &policy); err != nil {
+		return responsePolicy{}, err
+	}
+	return policy, nil
+}
@@ -0,0 +1,243 @@
+package transaction
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	commons "github.com/mat-sik/sql-distributed-transactions/common/transaction"
+)
+
+func TestClassify(t *testing.T) {
+	classifier, err := newResponseClassifier(
+		[]string{"5xx", "429", string(commons.NetworkErrorSelector)},
+		[]string{"400-428"},
+	)
+	if err != nil {
+		t.Fatalf("newResponseClassifier() error = %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		classifier responseClassifier
+		result     callResult
+		want       state
+	}{
+		{
+			name:       "success",
+			classifier: classifier,
+			result:     callResult{StatusCode: 200},
+			want:       DONE,
+		},
+		{
+			name:       "status class",
+			classifier: classifier,
+			result:     callResult{StatusCode: 503},
+			want:       RETRY,
+		},
+		{
+			name:       "status code",
+			classifier: classifier,
+			result:     callResult{StatusCode: 429},
+			want:       RETRY,
+		},
+		{
+			name:       "status range",
+			classifier: classifier,
+			result:     callResult{StatusCode: 404},
+			want:       FAILED,
+		},
+		{
+			name:       "status outside of every selector",
+			classifier: classifier,
+			result:     callResult{StatusCode: 431},
+			want:       DONE,
+		},
+		{
+			name:       "network error",
+			classifier: classifier,
+			result:     callResult{Failure: commons.NetworkErrorSelector},
+			want:       RETRY,
+		},
+		{
+			name:       "failure outside of every selector",
+			classifier: classifier,
+			result:     callResult{Failure: commons.TimeoutSelector},
+			want:       DONE,
+		},
+		{
+			name:       "fail on takes precedence over retry on",
+			classifier: classifier.withPolicy(responsePolicy{FailOn: []commons.StatusSelector{"503"}}),
+			result:     callResult{StatusCode: 503},
+			want:       FAILED,
+		},
+		{
+			name:       "empty policy list overrides the server-wide list",
+			classifier: classifier.withPolicy(responsePolicy{RetryOn: []commons.StatusSelector{}}),
+			result:     callResult{StatusCode: 503},
+			want:       DONE,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.classifier.classify(tt.result); got != tt.want {
+				t.Errorf("classify() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewResponseClassifierRejectsInvalidSelector(t *testing.T) {
+	if _, err := newResponseClassifier([]string{"5xx", "6xx"}, nil); err == nil {
+		t.Error("newResponseClassifier() error = nil, want an error")
+	}
+}
+
+func TestMatchesAny(t *testing.T) {
+	tests := []struct {
+		name      string
+		selectors []commons.StatusSelector
+		result    callResult
+		want      bool
+	}{
+		{
+			name:      "no selectors",
+			selectors: nil,
+			result:    callResult{StatusCode: 500},
+			want:      false,
+		},
+		{
+			name:      "lower bound of a range",
+			selectors: []commons.StatusSelector{"500-504"},
+			result:    callResult{StatusCode: 500},
+			want:      true,
+		},
+		{
+			name:      "upper bound of a range",
+			selectors: []commons.StatusSelector{"500-504"},
+			result:    callResult{StatusCode: 504},
+			want:      true,
+		},
+		{
+			name:      "just above a range",
+			selectors: []commons.StatusSelector{"500-504"},
+			result:    callResult{StatusCode: 505},
+			want:      false,
+		},
+		{
+			name:      "second selector",
+			selectors: []commons.StatusSelector{"429", "5xx"},
+			result:    callResult{StatusCode: 599},
+			want:      true,
+		},
+		{
+			name:      "failure selector",
+			selectors: []commons.StatusSelector{"5xx", commons.TimeoutSelector},
+			result:    callResult{Failure: commons.TimeoutSelector},
+			want:      true,
+		},
+		{
+			name:      "failure does not match status selectors",
+			selectors: []commons.StatusSelector{"1xx", "2xx", "3xx", "4xx", "5xx"},
+			result:    callResult{Failure: commons.NetworkErrorSelector},
+			want:      false,
+		},
+		{
+			name:      "status code does not match failure selectors",
+			selectors: []commons.StatusSelector{commons.NetworkErrorSelector, commons.TimeoutSelector},
+			result:    callResult{StatusCode: 500},
+			want:      false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := matchesAny(tt.selectors, tt.result); got != tt.want {
+				t.Errorf("matchesAny() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2025, 3, 10, 12, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		value string
+		want  time.Duration
+	}{
+		{
+			name:  "missing",
+			value: "",
+			want:  0,
+		},
+		{
+			name:  "seconds",
+			value: "120",
+			want:  2 * time.Minute,
+		},
+		{
+			name:  "negative seconds",
+			value: "-5",
+			want:  0,
+		},
+		{
+			name:  "date in the future",
+			value: "Mon, 10 Mar 2025 12:31:30 GMT",
+			want:  90 * time.Second,
+		},
+		{
+			name:  "date in the past",
+			value: "Mon, 10 Mar 2025 12:00:00 GMT",
+			want:  0,
+		},
+		{
+			name:  "date in the RFC 850 format",
+			value: "Monday, 10-Mar-25 12:31:00 GMT",
+			want:  time.Minute,
+		},
+		{
+			name:  "invalid",
+			value: "soon",
+			want:  0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseRetryAfter(tt.value, now); got != tt.want {
+				t.Errorf("parseRetryAfter(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewCallResultRetryAfter(t *testing.T) {
+	tests := []struct {
+		name       string
+		statusCode int
+		retryAfter string
+		want       time.Duration
+	}{
+		{name: "too many requests", statusCode: http.StatusTooManyRequests, retryAfter: "30", want: 30 * time.Second},
+		{name: "service unavailable", statusCode: http.StatusServiceUnavailable, retryAfter: "30", want: 30 * time.Second},
+		{name: "internal server error", statusCode: http.StatusInternalServerError, retryAfter: "30", want: 0},
+		{name: "bad gateway", statusCode: http.StatusBadGateway, retryAfter: "30", want: 0},
+		{name: "too many requests without the header", statusCode: http.StatusTooManyRequests, want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			if tt.retryAfter != "" {
+				header.Set("Retry-After", tt.retryAfter)
+			}
+			result := newCallResult(remoteResponse{StatusCode: tt.statusCode, Header: header}, nil)
+			if result.RetryAfter != tt.want {
+				t.Errorf("newCallResult() retry after = %v, want %v", result.RetryAfter, tt.want)
+			}
+		})
+	}
+}
@@ -4,7 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"errors"
-	"github.com/cenkalti/backoff/v5"
+	"fmt"
 	"github.com/mat-sik/sql-distributed-transactions/server/internal/config"
 	"github.com/mat-sik/sql-distributed-transactions/server/internal/tracing"
 	"go.opentelemetry.io/otel"
@@ -14,41 +14,118 @@ import (
 	"go.opentelemetry.io/otel/trace"
 	"log/slog"
 	"net/http"
+	"os"
 	"sync"
 	"time"
 )
 
 type Executor struct {
 	tracer       trace.Tracer
-	meter        metric.Meter
+	metrics      executorMetrics
 	repository   Repository
 	remoteClient remoteClient
+	retryPolicy  retryPolicy
+	classifier   responseClassifier
+	breakers     *CircuitBreakers
+	limiters     *HostLimiters
+	listener     *Listener
 	config       config.Executor
 }
 
-func NewExecutor(tracer trace.Tracer, meter metric.Meter, repository Repository, client *http.Client, config config.Executor) Executor {
-	return Executor{
-		tracer:       tracer,
-		meter:        meter,
-		repository:   repository,
-		remoteClient: remoteClient{client: client},
-		config:       config,
+func NewExecutor(
+	tracer trace.Tracer,
+	meter metric.Meter,
+	repository Repository,
+	client *http.Client,
+	breakers *CircuitBreakers,
+	limiters *HostLimiters,
+	listener *Listener,
+	config config.Executor,
+) (Executor, error) {
+	classifier, err := newResponseClassifier(config.RetryOn, config.FailOn)
+	if err != nil {
+		return Executor{}, err
+	}
+
+	metrics, err := newExecutorMetrics(meter, repository, breakers, config.QueueMetricsInterval)
+	if err != nil {
+		return Executor{}, err
 	}
+
+	return Executor{
+		tracer:     tracer,
+		metrics:    metrics,
+		repository: repository,
+		remoteClient: remoteClient{
+			client:      client,
+			maxBodySize: config.MaxRecordedBodySize,
+		},
+		retryPolicy: retryPolicy{
+			baseDelay: config.RetryBaseDelay,
+			maxDelay:  config.RetryMaxDelay,
+		},
+		classifier: classifier,
+		breakers:   breakers,
+		limiters:   limiters,
+		listener:   listener,
+		config:     config,
+	}, nil
 }
 
 func (e Executor) Start(ctx context.Context) {
 	slog.Info("starting the executor", "worker amount", e.config.WorkerAmount, "sender amount", e.config.SenderAmount, "batch size", e.config.BatchSize)
 
 	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		c := coordinator{
+			tracer:     e.tracer,
+			repository: e.repository,
+			config:     e.config,
+		}
+		c.start(ctx)
+	}()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		s := scheduler{
+			tracer:     e.tracer,
+			repository: e.repository,
+			config:     e.config,
+		}
+		s.start(ctx)
+	}()
+
+	wakeups := make([]<-chan struct{}, e.config.WorkerAmount)
+	for i := range wakeups {
+		wakeups[i] = e.listener.subscribe()
+	}
+	if e.config.ListenForTransactions {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			e.listener.start(ctx)
+		}()
+	}
+
+	leasePrefix := newLeasePrefix()
 	for i := 0; i < e.config.WorkerAmount; i++ {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
 			worker := workerExecutor{
+				id:           fmt.Sprintf("%s-%d", leasePrefix, i),
 				tracer:       e.tracer,
-				meter:        e.meter,
+				metrics:      e.metrics,
 				repository:   e.repository,
 				remoteClient: e.remoteClient,
+				retryPolicy:  e.retryPolicy,
+				classifier:   e.classifier,
+				breakers:     e.breakers,
+				limiters:     e.limiters,
+				wakeup:       wakeups[i],
 				config:       e.config,
 			}
 			worker.start(ctx)
@@ -57,66 +134,84 @@ func (e Executor) Start(ctx context.Context) {
 	wg.Wait()
 }
 
+// newLeasePrefix identifies this server process in the leased_by column of the claimed transactions.
+func newLeasePrefix() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	return fmt.Sprintf("%s-%d", hostname, os.Getpid())
+}
+
 type workerExecutor struct {
+	id           string
 	tracer       trace.Tracer
-	meter        metric.Meter
+	metrics      executorMetrics
 	repository   Repository
 	remoteClient remoteClient
+	retryPolicy  retryPolicy
+	classifier   responseClassifier
+	breakers     *CircuitBreakers
+	limiters     *HostLimiters
+	wakeup       <-chan struct{}
 	config       config.Executor
 }
 
 func (e workerExecutor) start(ctx context.Context) {
 	ticker := time.NewTicker(e.config.ExecuteTransactionInterval)
+	defer ticker.Stop()
 
 	for {
 		select {
 		case <-ctx.Done():
 			return
 		case <-ticker.C:
-			err := e.execTransactionBatch(ctx)
-			if err != nil {
-				slog.Error("encountered error while trying to execute a transaction", "error", err)
-			}
+		case <-e.wakeup:
 		}
+		e.execTransactionBatches(ctx)
 	}
 }
 
-func (e workerExecutor) execTransactionBatch(ctx context.Context) (err error) {
-	ctx, span := e.tracer.Start(ctx, "executeTransactionBatch")
-	defer span.End()
-
-	span.AddEvent("Trying to begin a sql transaction")
-	tx, err := e.repository.beginTx(ctx, nil)
-	if err != nil {
-		tracing.RecordErr(span, err, "Failed to begin a sql transaction", nil)
-		return err
-	}
-	defer func() {
-		span.AddEvent("Trying to finalize the sql transaction")
-		err = e.repository.finishTx(tx, err)
+// execTransactionBatches claims the next batch right away as long as the batches come back full, since more
+// transactions are likely to be due.
+func (e workerExecutor) execTransactionBatches(ctx context.Context) {
+	for ctx.Err() == nil {
+		claimed, err := e.execTransactionBatch(ctx)
 		if err != nil {
-			tracing.RecordErr(span, err, "Failed to finalize the sql transaction", nil)
+			slog.Error("encountered error while trying to execute a transaction", "error", err)
+			return
+		}
+		if claimed < e.config.BatchSize {
+			return
 		}
-	}()
-
-	span.AddEvent("Trying to fetch locked transactions")
-	transactions, err := e.repository.fetchLockedTransactions(ctx, tx, e.config.BatchSize)
-	if errors.Is(err, sql.ErrNoRows) {
-		span.RecordError(err)
-		return nil
 	}
+}
+
+func (e workerExecutor) execTransactionBatch(ctx context.Context) (int, error) {
+	ctx, span := e.tracer.Start(ctx, "executeTransactionBatch")
+	defer span.End()
+
+	span.AddEvent("Trying to claim transactions", trace.WithAttributes(
+		attribute.String("leased by", e.id),
+	))
+	transactions, err := e.repository.claimTransactions(ctx, e.id, e.config.LeaseDuration, e.config.PriorityAgingInterval, e.config.BatchSize)
 	if err != nil {
-		tracing.RecordErr(span, err, "Encountered error while fetching the locked transactions", nil)
-		return err
+		tracing.RecordErr(span, err, "Encountered error while claiming the transactions", nil)
+		return 0, err
 	}
-	span.AddEvent("Fetched locked transactions", trace.WithAttributes(
+	e.metrics.recordClaimed(ctx, transactions, e.config.BatchSize, time.Now())
+	span.AddEvent("Claimed transactions", trace.WithAttributes(
 		attribute.Int("transaction count", len(transactions)),
 	))
+	if len(transactions) == 0 {
+		return 0, nil
+	}
 
-	return e.tryExecRemoteTransactions(ctx, tx, transactions)
+	e.tryExecRemoteTransactions(ctx, transactions)
+	return len(transactions), nil
 }
 
-func (e workerExecutor) tryExecRemoteTransactions(ctx context.Context, tx *sql.Tx, transactions []transaction) error {
+func (e workerExecutor) tryExecRemoteTransactions(ctx context.Context, transactions []transaction) {
 	ctx, span := e.tracer.Start(ctx, "tryExecRemoteTransactions")
 	defer span.End()
 
@@ -136,26 +231,22 @@ func (e workerExecutor) tryExecRemoteTransactions(ctx context.Context, tx *sql.T
 	defer wg.Wait()
 
 	executedCount := 0
-	var err error
 	for i := 0; i < len(transactions); i++ {
 		select {
 		case <-ctx.Done():
-			err = errors.New("failed to execute each one of transactions because of the timeout or cancellation")
+			err := errors.New("failed to execute each one of transactions because of the timeout or cancellation")
 			tracing.RecordErr(span, err, "Failed to execute all transactions", trace.WithAttributes(
 				attribute.Int("executed count", executedCount),
 			))
-			return nil
+			return
 		case tResp := <-responsesCh:
-			executedCount, err = e.handleTransactionResponse(ctx, tx, tResp, executedCount)
-			if err != nil {
-				tracing.RecordErr(span, err, "Failed to execute all transactions", trace.WithAttributes(
-					attribute.Int("executed count", executedCount),
-				))
-				return err
-			}
+			// A failed write-back leaves the transaction leased, so it is picked up again once the lease expires.
+			executedCount = e.handleTransactionResponse(ctx, tResp, executedCount)
 		}
 	}
-	return nil
+	span.AddEvent("Handled all transactions in the batch", trace.WithAttributes(
+		attribute.Int("executed count", executedCount),
+	))
 }
 
 func (e workerExecutor) produceTransactions(ctx context.Context, wg *sync.WaitGroup, toSendCh chan<- transaction, transactions []transaction) {
@@ -178,34 +269,26 @@ func (e workerExecutor) produceTransactions(ctx context.Context, wg *sync.WaitGr
 	}
 }
 
-func (e workerExecutor) handleTransactionResponse(ctx context.Context, tx *sql.Tx, tResp transactionResponse, executedCount int) (int, error) {
+func (e workerExecutor) handleTransactionResponse(ctx context.Context, tResp transactionResponse, executedCount int) int {
 	ctx = otel.GetTextMapPropagator().Extract(ctx, tResp.carrier)
 
 	ctx, span := e.tracer.Start(ctx, "handleTransactionResponse")
 	defer span.End()
 
-	if tResp.ID == 0 && tResp.StatusCode == 0 {
-		span.AddEvent("Failed to execute a transaction because of the timeout", trace.WithAttributes(
-			attribute.Int("executed count", executedCount),
-			attribute.Int("transaction id", tResp.ID),
-		))
-		return executedCount, nil
-	}
-
 	span.AddEvent("Trying to update transaction state")
-	if err := e.updateTransactionState(ctx, tx, tResp); err != nil {
+	if err := e.updateTransactionState(ctx, tResp); err != nil {
 		tracing.RecordErr(span, err, "Failed to update a transaction state", trace.WithAttributes(
 			attribute.Int("transaction id", tResp.ID),
 			attribute.Int("transaction result status code", tResp.StatusCode),
 		))
-		return executedCount, err
+		return executedCount
 	}
 
 	executedCount++
 	span.AddEvent("Updated the transaction state", trace.WithAttributes(
 		attribute.Int("executed count", executedCount),
 	))
-	return executedCount, nil
+	return executedCount
 }
 
 func (e workerExecutor) execSender(
@@ -232,26 +315,100 @@ func (e workerExecutor) execSender(
 				return
 			}
 
-			tResp, err := e.handleTransaction(ctx, t)
-			if err != nil {
-				tracing.RecordErr(span, err, "Failed to handle the transaction", trace.WithAttributes(
-					attribute.Int("transaction id", t.ID),
-				))
-				return
-			}
-			responsesCh <- tResp
+			responsesCh <- e.handleTransaction(ctx, t)
 		}
 	}
 }
 
-func (e workerExecutor) handleTransaction(ctx context.Context, t transaction) (transactionResponse, error) {
+// leaseAboutToExpire reports whether the lease could expire before a request sent now times out.
+func (e workerExecutor) leaseAboutToExpire(t transaction) bool {
+	return time.Until(t.LeaseExpiresAt) < e.config.RequestTimeout
+}
+
+func (e workerExecutor) handleTransaction(ctx context.Context, t transaction) transactionResponse {
 	ctx, span := e.tracer.Start(ctx, "handleTransaction")
 	defer span.End()
 
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+
+	tResp := transactionResponse{
+		ID:               t.ID,
+		Host:             t.Host,
+		CreatedAt:        t.CreatedAt,
+		SagaID:           t.SagaID,
+		TwoPhaseCommitID: t.TwoPhaseCommitID,
+		ExpiresAt:        t.ExpiresAt,
+		Priority:         t.Priority,
+		Attempts:         t.Attempts,
+		MaxAttempts:      e.maxAttempts(t),
+		carrier:          carrier,
+	}
+
+	if t.ExpiresAt.Valid && time.Now().After(t.ExpiresAt.Time) {
+		span.AddEvent("Abandoning the transaction because it has expired", trace.WithAttributes(
+			attribute.Int("transaction id", t.ID),
+			attribute.String("expires at", t.ExpiresAt.Time.Format(time.RFC3339)),
+		))
+		tResp.Expired = true
+		return tResp
+	}
+
+	// The transaction waited in the batch for too long, and the lease could expire while the request is still running,
+	// which would let another worker send it concurrently.
+	if e.leaseAboutToExpire(t) {
+		span.AddEvent("Releasing the transaction because its lease is about to expire", trace.WithAttributes(
+			attribute.Int("transaction id", t.ID),
+		))
+		tResp.Released = true
+		return tResp
+	}
+
+	if allowed, retryAfter := e.breakers.allow(t.Host, time.Now()); !allowed {
+		span.AddEvent("Rescheduling the transaction because the circuit of its host is open", trace.WithAttributes(
+			attribute.Int("transaction id", t.ID),
+			attribute.String("host", t.Host),
+		))
+		e.metrics.recordShortCircuited(ctx, t.Host)
+		tResp.Released = true
+		tResp.RetryAfter = retryAfter
+		return tResp
+	}
+
+	release, retryAfter, err := e.limiters.acquire(ctx, t.Host)
+	if err != nil {
+		tracing.RecordErr(span, err, "Failed to check the limits of the host, releasing the transaction", nil)
+		e.breakers.abandon(t.Host)
+		tResp.Released = true
+		return tResp
+	}
+	if release == nil {
+		span.AddEvent("Rescheduling the transaction because its host is at its limits", trace.WithAttributes(
+			attribute.Int("transaction id", t.ID),
+			attribute.String("host", t.Host),
+		))
+		e.metrics.recordRateLimited(ctx, t.Host)
+		e.breakers.abandon(t.Host)
+		tResp.Released = true
+		tResp.RetryAfter = retryAfter
+		return tResp
+	}
+	// Waiting for the limits of the host takes up to the configured maximum, so the lease is checked once more.
+	if e.leaseAboutToExpire(t) {
+		span.AddEvent("Releasing the transaction because its lease is about to expire after waiting for its host", trace.WithAttributes(
+			attribute.Int("transaction id", t.ID),
+		))
+		release()
+		e.breakers.abandon(t.Host)
+		tResp.Released = true
+		return tResp
+	}
+	defer release()
+
 	storedCtx, err := tracing.UnmarshalContext(ctx, t.CarrierJSON)
 	if err != nil {
-		tracing.RecordErr(span, err, "Failed to unmarshal the trace context", nil)
-		return transactionResponse{}, err
+		tracing.RecordErr(span, err, "Failed to unmarshal the trace context, continuing without it", nil)
+		storedCtx = ctx
 	}
 
 	spanLinkOption := trace.WithLinks(trace.LinkFromContext(ctx))
@@ -259,26 +416,55 @@ func (e workerExecutor) handleTransaction(ctx context.Context, t transaction) (t
 	span.AddEvent("Trying to execute a remote transaction", trace.WithAttributes(
 		attribute.Int("transaction id", t.ID),
 	))
+	startedAt := time.Now()
+	recordCall := e.metrics.recordCall(ctx, t.Host, startedAt)
 	resp, err := e.tryExecRemoteTransaction(storedCtx, spanLinkOption, t)
+	finishedAt := time.Now()
+	result := newCallResult(resp, err)
+	recordCall(result, finishedAt)
+	if err != nil && ctx.Err() != nil {
+		span.AddEvent("Releasing the transaction because the executor is shutting down")
+		e.breakers.abandon(t.Host)
+		tResp.Released = true
+		return tResp
+	}
 	if err != nil {
 		tracing.RecordErr(span, err, "Failed to execute the transaction", nil)
+	} else {
+		span.AddEvent("Executed the remote transaction", trace.WithAttributes(
+			attribute.Int("response status", resp.StatusCode),
+		))
 	}
-	span.AddEvent("Executed the remote transaction", trace.WithAttributes(
-		attribute.Int("response status", resp.StatusCode),
+
+	e.breakers.record(t.Host, callFailed(result), finishedAt)
+	tResp.StatusCode = result.StatusCode
+	tResp.StatusClass = statusClass(result)
+	// The downstream cannot park a transaction for longer than our own backoff would.
+	tResp.RetryAfter = min(result.RetryAfter, e.config.RetryMaxDelay)
+	tResp.Outcome = e.classifierFor(span, t).classify(result)
+	span.AddEvent("Classified the remote transaction outcome", trace.WithAttributes(
+		attribute.String("outcome", string(tResp.Outcome)),
+		attribute.String("failure", string(result.Failure)),
 	))
 
-	carrier := propagation.MapCarrier{}
-	otel.GetTextMapPropagator().Inject(ctx, carrier)
+	tResp.Attempt = newTransactionAttempt(t.ID, startedAt, finishedAt, resp, err, e.config.RecordedResponseHeaders)
+	return tResp
+}
 
-	tResp := transactionResponse{
-		ID:         t.ID,
-		StatusCode: resp.StatusCode,
-		carrier:    carrier,
+func (e workerExecutor) classifierFor(span trace.Span, t transaction) responseClassifier {
+	if !t.ResponsePolicy.Valid {
+		return e.classifier
+	}
+
+	policy, err := parseResponsePolicy(t.ResponsePolicy.String)
+	if err != nil {
+		tracing.RecordErr(span, err, "Failed to parse the response policy, falling back to the server-wide one", nil)
+		return e.classifier
 	}
-	return tResp, nil
+	return e.classifier.withPolicy(policy)
 }
 
-func (e workerExecutor) tryExecRemoteTransaction(ctx context.Context, option trace.SpanStartOption, t transaction) (*http.Response, error) {
+func (e workerExecutor) tryExecRemoteTransaction(ctx context.Context, option trace.SpanStartOption, t transaction) (remoteResponse, error) {
 	ctx, span := e.tracer.Start(ctx, "tryExecRemoteTransaction", option)
 	defer span.End()
 
@@ -286,13 +472,16 @@ func (e workerExecutor) tryExecRemoteTransaction(ctx context.Context, option tra
 		attribute.Int("transaction id", t.ID),
 	))
 
-	operation := func() (*http.Response, error) {
-		return e.remoteClient.tryExecRemoteTransaction(ctx, t)
-	}
-	resp, err := backoff.Retry(ctx, operation, backoff.WithBackOff(backoff.NewExponentialBackOff()))
+	ctx, cancel := context.WithTimeout(ctx, e.config.RequestTimeout)
+	defer cancel()
+
+	resp, err := e.remoteClient.tryExecRemoteTransaction(ctx, t)
 	if err != nil {
 		tracing.RecordErr(span, err, "Failed to execute the transaction", nil)
-		return nil, err
+		return remoteResponse{}, err
+	}
+	if resp.BodyErr != nil {
+		tracing.RecordErr(span, resp.BodyErr, "Failed to read the response body", nil)
 	}
 
 	span.AddEvent("Executed the remote transaction", trace.WithAttributes(
@@ -302,31 +491,138 @@ func (e workerExecutor) tryExecRemoteTransaction(ctx context.Context, option tra
 	return resp, err
 }
 
-func (e workerExecutor) updateTransactionState(ctx context.Context, tx *sql.Tx, tResp transactionResponse) error {
+func (e workerExecutor) updateTransactionState(ctx context.Context, tResp transactionResponse) (err error) {
 	ctx, span := e.tracer.Start(ctx, "updateTransactionState")
 	defer span.End()
 
-	newState := DONE
-	if tResp.StatusCode == http.StatusInternalServerError {
-		newState = RETRY
+	update := transactionUpdate{
+		ID:         tResp.ID,
+		LeasedBy:   e.id,
+		State:      tResp.Outcome,
+		StatusCode: tResp.StatusCode,
+		Attempted:  true,
+	}
+	if tResp.Released {
+		update.State = RETRY
+		update.RetryDelay = tResp.RetryAfter
+		update.Attempted = false
+	} else if tResp.Expired {
+		update.State = EXPIRED
+		update.Attempted = false
+	} else if tResp.Outcome == RETRY {
+		// The downstream may know better than our backoff when it is going to be ready again.
+		update.RetryDelay = max(e.retryPolicy.delay(tResp.Attempts+1), tResp.RetryAfter)
+		if tResp.Attempts+1 >= tResp.MaxAttempts {
+			span.AddEvent("The transaction has exhausted its attempts", trace.WithAttributes(
+				attribute.Int("max attempts", tResp.MaxAttempts),
+			))
+			update.State = FAILED
+		} else if tResp.ExpiresAt.Valid && time.Now().Add(update.RetryDelay).After(tResp.ExpiresAt.Time) {
+			span.AddEvent("The transaction is going to expire before its next attempt", trace.WithAttributes(
+				attribute.String("expires at", tResp.ExpiresAt.Time.Format(time.RFC3339)),
+			))
+			update.State = EXPIRED
+		}
 	}
 
 	span.AddEvent("Trying to update the transaction state", trace.WithAttributes(
-		attribute.String("new state", string(newState)),
+		attribute.String("new state", string(update.State)),
+		attribute.Float64("retry delay seconds", update.RetryDelay.Seconds()),
 	))
 
-	err := e.repository.updateLockedTransactionState(ctx, tx, tResp.ID, newState)
+	var updated bool
+	span.AddEvent("Trying to begin a sql transaction")
+	tx, err := e.repository.beginTx(ctx, nil)
+	if err != nil {
+		tracing.RecordErr(span, err, "Failed to begin a sql transaction", nil)
+		return err
+	}
+	defer func() {
+		span.AddEvent("Trying to finalize the sql transaction")
+		err = e.repository.finishTx(tx, err)
+		if err != nil {
+			tracing.RecordErr(span, err, "Failed to finalize the sql transaction", nil)
+			return
+		}
+		if !updated {
+			return
+		}
+		if update.Attempted {
+			e.metrics.recordAttempted(ctx, tResp, update.State, time.Now())
+		}
+		if update.State.isTerminal() {
+			e.metrics.recordFinished(ctx, tResp.Priority, update.State)
+		}
+	}()
+
+	updated, err = e.repository.updateLeasedTransactionState(ctx, tx, update)
 	if err != nil {
 		tracing.RecordErr(span, err, "Failed to update the transaction state", nil)
 		return err
 	}
+	if !updated {
+		span.AddEvent("The lease has been lost, the transaction is owned by another worker now")
+		return nil
+	}
+
+	if update.Attempted {
+		span.AddEvent("Trying to record the transaction attempt")
+		if err = e.repository.insertTransactionAttempt(ctx, tx, tResp.Attempt); err != nil {
+			tracing.RecordErr(span, err, "Failed to record the transaction attempt", nil)
+			return err
+		}
+	}
+
+	if tResp.SagaID.Valid && update.State.isTerminal() {
+		span.AddEvent("Trying to advance the saga", trace.WithAttributes(
+			attribute.Int64("saga id", tResp.SagaID.Int64),
+		))
+		if err = e.repository.advanceSaga(ctx, tx, tResp.ID, update.State); err != nil {
+			tracing.RecordErr(span, err, "Failed to advance the saga", nil)
+			return err
+		}
+	}
+
+	if tResp.TwoPhaseCommitID.Valid && update.State.isTerminal() {
+		span.AddEvent("Trying to reconcile the two-phase commit", trace.WithAttributes(
+			attribute.Int64("two-phase commit id", tResp.TwoPhaseCommitID.Int64),
+		))
+		if err = e.repository.reconcileTwoPhaseCommit(ctx, tx, int(tResp.TwoPhaseCommitID.Int64)); err != nil {
+			tracing.RecordErr(span, err, "Failed to reconcile the two-phase commit", nil)
+			return err
+		}
+	}
 	return nil
 }
 
+func (e workerExecutor) maxAttempts(t transaction) int {
+	if t.MaxAttempts.Valid {
+		return int(t.MaxAttempts.Int32)
+	}
+	return e.config.MaxAttempts
+}
+
 type transactionResponse struct {
-	ID         int
-	StatusCode int
-	carrier    propagation.MapCarrier
+	ID               int
+	Host             string
+	CreatedAt        time.Time
+	SagaID           sql.NullInt64
+	TwoPhaseCommitID sql.NullInt64
+	StatusCode       int
+	StatusClass      string
+	Attempts         int
+	MaxAttempts      int
+	Outcome          state
+	RetryAfter       time.Duration
+	Attempt          transactionAttempt
+	ExpiresAt        sql.NullTime
+	Priority         int
+	// Released is set when the transaction has not been sent and should go back to the queue without using an attempt.
+	// It is due again after RetryAfter.
+	Released bool
+	// Expired is set when the transaction has passed its deadline, so it has not been sent.
+	Expired bool
+	carrier propagation.MapCarrier
 }
 
 const maxChannelSize = 10_240
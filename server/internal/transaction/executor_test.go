@@ -0,0 +1,274 @@
+package transaction
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/mat-sik/sql-distributed-transactions/server/internal/config"
+	metricnoop "go.opentelemetry.io/otel/metric/noop"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// recordingRepository records the state updates, and leaves every other method of the Repository unimplemented.
+type recordingRepository struct {
+	Repository
+	leaseLost bool
+	updates   []transactionUpdate
+	attempts  []transactionAttempt
+}
+
+func (r *recordingRepository) beginTx(context.Context, *sql.TxOptions) (*sql.Tx, error) {
+	return nil, nil
+}
+
+func (r *recordingRepository) finishTx(_ *sql.Tx, err error) error {
+	return err
+}
+
+func (r *recordingRepository) insertTransactionAttempt(_ context.Context, _ *sql.Tx, attempt transactionAttempt) error {
+	r.attempts = append(r.attempts, attempt)
+	return nil
+}
+
+func (r *recordingRepository) updateLeasedTransactionState(_ context.Context, _ *sql.Tx, update transactionUpdate) (bool, error) {
+	r.updates = append(r.updates, update)
+	return !r.leaseLost, nil
+}
+
+func newTestWorkerExecutor(t *testing.T, repository Repository) workerExecutor {
+	breakers := NewCircuitBreakers(config.Executor{})
+	metrics, err := newExecutorMetrics(metricnoop.NewMeterProvider().Meter(""), repository, breakers, time.Minute)
+	if err != nil {
+		t.Fatalf("newExecutorMetrics() error = %v", err)
+	}
+	limiters, err := NewHostLimiters(config.RateLimits{}, repository)
+	if err != nil {
+		t.Fatalf("NewHostLimiters() error = %v", err)
+	}
+	return workerExecutor{
+		id:          "worker-1",
+		tracer:      noop.NewTracerProvider().Tracer(""),
+		repository:  repository,
+		metrics:     metrics,
+		breakers:    breakers,
+		limiters:    limiters,
+		retryPolicy: retryPolicy{baseDelay: time.Second, maxDelay: time.Minute},
+	}
+}
+
+func TestUpdateTransactionState(t *testing.T) {
+	tests := []struct {
+		name          string
+		tResp         transactionResponse
+		want          state
+		wantAttempted bool
+		minRetryDelay time.Duration
+	}{
+		{
+			name:          "done",
+			tResp:         transactionResponse{StatusCode: 200, Outcome: DONE, Attempts: 2, MaxAttempts: 3},
+			want:          DONE,
+			wantAttempted: true,
+		},
+		{
+			name:          "retry with attempts left",
+			tResp:         transactionResponse{StatusCode: 503, Outcome: RETRY, Attempts: 1, MaxAttempts: 3},
+			want:          RETRY,
+			wantAttempted: true,
+		},
+		{
+			name:          "retry on the last attempt",
+			tResp:         transactionResponse{StatusCode: 503, Outcome: RETRY, Attempts: 2, MaxAttempts: 3},
+			want:          FAILED,
+			wantAttempted: true,
+		},
+		{
+			name:          "retry with a single attempt allowed",
+			tResp:         transactionResponse{Outcome: RETRY, Attempts: 0, MaxAttempts: 1},
+			want:          FAILED,
+			wantAttempted: true,
+		},
+		{
+			name:          "failed with attempts left",
+			tResp:         transactionResponse{StatusCode: 400, Outcome: FAILED, Attempts: 0, MaxAttempts: 3},
+			want:          FAILED,
+			wantAttempted: true,
+		},
+		{
+			name:          "retry after a delay longer than the backoff",
+			tResp:         transactionResponse{StatusCode: 429, Outcome: RETRY, RetryAfter: time.Hour, MaxAttempts: 3},
+			want:          RETRY,
+			wantAttempted: true,
+			minRetryDelay: time.Hour,
+		},
+		{
+			name: "retry after the deadline",
+			tResp: transactionResponse{
+				Outcome:     RETRY,
+				MaxAttempts: 3,
+				ExpiresAt:   sql.NullTime{Time: time.Now().Add(time.Millisecond), Valid: true},
+				RetryAfter:  time.Minute,
+			},
+			want:          EXPIRED,
+			wantAttempted: true,
+		},
+		{
+			name: "retry before the deadline",
+			tResp: transactionResponse{
+				Outcome:     RETRY,
+				MaxAttempts: 3,
+				ExpiresAt:   sql.NullTime{Time: time.Now().Add(time.Hour), Valid: true},
+			},
+			want:          RETRY,
+			wantAttempted: true,
+		},
+		{
+			name:  "expired before the call",
+			tResp: transactionResponse{Expired: true, MaxAttempts: 3},
+			want:  EXPIRED,
+		},
+		{
+			name:  "released before the call",
+			tResp: transactionResponse{Released: true, Attempts: 2, MaxAttempts: 3},
+			want:  RETRY,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repository := &recordingRepository{}
+			e := newTestWorkerExecutor(t, repository)
+
+			if err := e.updateTransactionState(context.Background(), tt.tResp); err != nil {
+				t.Fatalf("updateTransactionState() error = %v", err)
+			}
+			if len(repository.updates) != 1 {
+				t.Fatalf("updateTransactionState() made %d updates, want 1", len(repository.updates))
+			}
+			update := repository.updates[0]
+			if update.State != tt.want {
+				t.Errorf("updateTransactionState() state = %s, want %s", update.State, tt.want)
+			}
+			if update.LeasedBy != e.id || update.Attempted != tt.wantAttempted {
+				t.Errorf("updateTransactionState() update = %+v, want leased by %s and attempted %v", update, e.id, tt.wantAttempted)
+			}
+			if recorded := len(repository.attempts) == 1; recorded != tt.wantAttempted {
+				t.Errorf("updateTransactionState() recorded %d attempts, want the attempt recorded %v", len(repository.attempts), tt.wantAttempted)
+			}
+			if update.State == RETRY && update.Attempted && update.RetryDelay < max(tt.minRetryDelay, time.Nanosecond) {
+				t.Errorf("updateTransactionState() retry delay = %v, want at least %v", update.RetryDelay, tt.minRetryDelay)
+			}
+		})
+	}
+}
+
+func TestUpdateTransactionStateWithLostLease(t *testing.T) {
+	repository := &recordingRepository{leaseLost: true}
+	e := newTestWorkerExecutor(t, repository)
+
+	tResp := transactionResponse{StatusCode: 200, Outcome: DONE, Attempts: 0, MaxAttempts: 3}
+	if err := e.updateTransactionState(context.Background(), tResp); err != nil {
+		t.Errorf("updateTransactionState() error = %v, want the lost lease to be skipped", err)
+	}
+	if len(repository.attempts) != 0 {
+		t.Errorf("updateTransactionState() recorded %d attempts, want none after the lease has been lost", len(repository.attempts))
+	}
+}
+
+func TestHandleTransactionSkipsCall(t *testing.T) {
+	tests := []struct {
+		name         string
+		t            transaction
+		wantReleased bool
+		wantExpired  bool
+	}{
+		{
+			name:         "lease about to expire",
+			t:            transaction{ID: 1, LeaseExpiresAt: time.Now().Add(time.Second)},
+			wantReleased: true,
+		},
+		{
+			name: "deadline passed",
+			t: transaction{
+				ID:             1,
+				LeaseExpiresAt: time.Now().Add(time.Minute),
+				ExpiresAt:      sql.NullTime{Time: time.Now().Add(-time.Second), Valid: true},
+			},
+			wantExpired: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The remote client is left unset, so the test fails if the transaction is sent.
+			e := workerExecutor{
+				tracer: noop.NewTracerProvider().Tracer(""),
+				config: config.Executor{RequestTimeout: 5 * time.Second, MaxAttempts: 3},
+			}
+
+			tResp := e.handleTransaction(context.Background(), tt.t)
+			if tResp.Released != tt.wantReleased || tResp.Expired != tt.wantExpired {
+				t.Errorf("handleTransaction() released = %v, expired = %v, want %v and %v",
+					tResp.Released, tResp.Expired, tt.wantReleased, tt.wantExpired)
+			}
+		})
+	}
+}
+
+func TestMaxAttempts(t *testing.T) {
+	e := workerExecutor{config: config.Executor{MaxAttempts: 10}}
+
+	tests := []struct {
+		name        string
+		maxAttempts sql.NullInt32
+		want        int
+	}{
+		{name: "server-wide", want: 10},
+		{name: "per transaction", maxAttempts: sql.NullInt32{Int32: 3, Valid: true}, want: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := e.maxAttempts(transaction{MaxAttempts: tt.maxAttempts}); got != tt.want {
+				t.Errorf("maxAttempts() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandleTransactionReleasesAfterWaitingForHost(t *testing.T) {
+	const requestTimeout = 5 * time.Second
+
+	limiters, err := NewHostLimiters(config.RateLimits{
+		Default: config.RateLimit{RequestsPerSecond: 10, Burst: 1, MaxInFlight: 1},
+		MaxWait: time.Second,
+	}, nil)
+	if err != nil {
+		t.Fatalf("NewHostLimiters() error = %v", err)
+	}
+	// Taking the only token makes the next call wait for the following one, 100ms later.
+	release, _, err := limiters.acquire(context.Background(), "a.example.com")
+	if err != nil || release == nil {
+		t.Fatalf("acquire() acquired = %v, error = %v, want the slot acquired", release != nil, err)
+	}
+	release()
+
+	// The remote client is left unset, so the test fails if the transaction is sent.
+	e := newTestWorkerExecutor(t, nil)
+	e.limiters = limiters
+	e.config = config.Executor{RequestTimeout: requestTimeout, MaxAttempts: 3}
+
+	tResp := e.handleTransaction(context.Background(), transaction{
+		ID:             1,
+		Host:           "a.example.com",
+		LeaseExpiresAt: time.Now().Add(requestTimeout + 50*time.Millisecond),
+	})
+	if !tResp.Released {
+		t.Errorf("handleTransaction() released = false, want the transaction released once its lease got too short")
+	}
+	if release, _, _ := limiters.acquire(context.Background(), "a.example.com"); release == nil {
+		t.Error("handleTransaction() kept the in-flight slot of the released transaction")
+	}
+}
@@ -0,0 +1,194 @@
+package transaction
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/mat-sik/sql-distributed-transactions/server/internal/logging"
+	"slices"
+	"strings"
+
+	commons "github.com/mat-sik/sql-distributed-transactions/common/transaction"
+)
+
+type transactionFilter struct {
+	IDs           []int
+	States        []state
+	Host          string
+	Method        string
+	OrderingKey   string
+	StatusCodes   []int
+	CreatedAfter  sql.NullTime
+	CreatedBefore sql.NullTime
+	UpdatedAfter  sql.NullTime
+	UpdatedBefore sql.NullTime
+}
+
+func newTransactionFilter(f commons.ListTransactionsFilter) (transactionFilter, error) {
+	filterStates := make([]state, 0, len(f.States))
+	for _, name := range f.States {
+		s := state(strings.ToUpper(name))
+		if !s.isKnown() {
+			return transactionFilter{}, fmt.Errorf("state %s is unknown", name)
+		}
+		if !slices.Contains(filterStates, s) {
+			filterStates = append(filterStates, s)
+		}
+	}
+
+	return transactionFilter{
+		States:        filterStates,
+		Host:          f.Host,
+		Method:        strings.ToUpper(f.Method),
+		OrderingKey:   f.OrderingKey,
+		StatusCodes:   f.StatusCodes,
+		CreatedAfter:  toNullTime(f.CreatedAfter),
+		CreatedBefore: toNullTime(f.CreatedBefore),
+		UpdatedAfter:  toNullTime(f.UpdatedAfter),
+		UpdatedBefore: toNullTime(f.UpdatedBefore),
+	}, nil
+}
+
+// where returns the conditions of the filter joined with AND, with the placeholders numbered after the given args.
+func (f transactionFilter) where(args []any) (string, []any) {
+	conditions := []string{"TRUE"}
+	add := func(condition string, arg any) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	addIn := func(column string, values []any) {
+		if len(values) == 0 {
+			return
+		}
+		placeholders := make([]string, 0, len(values))
+		for _, value := range values {
+			args = append(args, value)
+			placeholders = append(placeholders, fmt.Sprintf("$%d", len(args)))
+		}
+		conditions = append(conditions, column+" IN ("+strings.Join(placeholders, ", ")+")")
+	}
+
+	addIn("id", toAnySlice(f.IDs))
+	addIn("state", toAnySlice(f.States))
+	addIn("last_status_code", toAnySlice(f.StatusCodes))
+	if f.Host != "" {
+		add("host = $%d", f.Host)
+	}
+	if f.Method != "" {
+		add("method = $%d", f.Method)
+	}
+	if f.OrderingKey != "" {
+		add("ordering_key = $%d", f.OrderingKey)
+	}
+	if f.CreatedAfter.Valid {
+		add("created_at >= $%d", f.CreatedAfter.Time)
+	}
+	if f.CreatedBefore.Valid {
+		add("created_at < $%d", f.CreatedBefore.Time)
+	}
+	if f.UpdatedAfter.Valid {
+		add("updated_at >= $%d", f.UpdatedAfter.Time)
+	}
+	if f.UpdatedBefore.Valid {
+		add("updated_at < $%d", f.UpdatedBefore.Time)
+	}
+	return strings.Join(conditions, " AND "), args
+}
+
+func toAnySlice[T any](values []T) []any {
+	result := make([]any, 0, len(values))
+	for _, value := range values {
+		result = append(result, value)
+	}
+	return result
+}
+
+func (r SQLRepository) fetchTransactions(ctx context.Context, filter transactionFilter, afterID int, limit int) ([]transactionStatus, error) {
+	where, args := filter.where([]any{afterID, limit})
+	query := `
+		SELECT ` + transactionStatusColumns + `
+		FROM transactions
+		WHERE id > $1 AND ` + where + `
+		ORDER BY id
+		LIMIT $2
+	`
+
+	stmt, err := r.pool.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer logging.LoggedClose(stmt)
+
+	rows, err := stmt.QueryContext(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer logging.LoggedClose(rows)
+
+	var transactions []transactionStatus
+	for rows.Next() {
+		t, err := scanTransactionStatus(rows)
+		if err != nil {
+			return nil, err
+		}
+		transactions = append(transactions, t)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return transactions, nil
+}
+
+// countTransactions returns the number of matching transactions in each state. The states without any transactions
+// are left out.
+func (r SQLRepository) countTransactions(ctx context.Context, filter transactionFilter) (map[state]int, error) {
+	where, args := filter.where(nil)
+	query := `
+		SELECT state, count(*)
+		FROM transactions
+		WHERE ` + where + `
+		GROUP BY state
+	`
+
+	stmt, err := r.pool.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer logging.LoggedClose(stmt)
+
+	rows, err := stmt.QueryContext(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer logging.LoggedClose(rows)
+
+	counts := make(map[state]int)
+	for rows.Next() {
+		var s state
+		var count int
+		if err = rows.Scan(&s, &count); err != nil {
+			return nil, err
+		}
+		counts[s] = count
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return counts, nil
+}
+
+func toCountTransactionsResponse(counts map[state]int) commons.CountTransactionsResponse {
+	resp := commons.CountTransactionsResponse{
+		Counts: make(map[string]int, len(counts)),
+	}
+	for s, count := range counts {
+		resp.Counts[string(s)] = count
+		resp.Total += count
+	}
+	return resp
+}
@@ -0,0 +1,117 @@
+package transaction
+
+import (
+	"database/sql"
+	"reflect"
+	"testing"
+	"time"
+
+	commons "github.com/mat-sik/sql-distributed-transactions/common/transaction"
+)
+
+func TestNewTransactionFilter(t *testing.T) {
+	tests := []struct {
+		name    string
+		filter  commons.ListTransactionsFilter
+		want    transactionFilter
+		wantErr bool
+	}{
+		{
+			name:   "empty",
+			filter: commons.ListTransactionsFilter{},
+			want:   transactionFilter{States: []state{}},
+		},
+		{
+			name:   "states and method are normalized",
+			filter: commons.ListTransactionsFilter{States: []string{"retry", "FAILED", "Retry"}, Method: "post"},
+			want:   transactionFilter{States: []state{RETRY, FAILED}, Method: "POST"},
+		},
+		{
+			name:    "unknown state",
+			filter:  commons.ListTransactionsFilter{States: []string{"RETRYING"}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := newTransactionFilter(tt.filter)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newTransactionFilter() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("newTransactionFilter() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTransactionFilterWhere(t *testing.T) {
+	createdAfter := time.Date(2025, 3, 10, 12, 30, 0, 0, time.UTC)
+	updatedBefore := time.Date(2025, 3, 11, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		filter    transactionFilter
+		args      []any
+		wantWhere string
+		wantArgs  []any
+	}{
+		{
+			name:      "empty",
+			filter:    transactionFilter{},
+			wantWhere: "TRUE",
+		},
+		{
+			name:      "placeholders follow the given args",
+			filter:    transactionFilter{Host: "dummy:40691", Method: "POST"},
+			args:      []any{10, 100},
+			wantWhere: "TRUE AND host = $3 AND method = $4",
+			wantArgs:  []any{10, 100, "dummy:40691", "POST"},
+		},
+		{
+			name:      "ids and status codes",
+			filter:    transactionFilter{IDs: []int{4, 2}, States: []state{FAILED}, StatusCodes: []int{503}},
+			wantWhere: "TRUE AND id IN ($1, $2) AND state IN ($3) AND last_status_code IN ($4)",
+			wantArgs:  []any{4, 2, FAILED, 503},
+		},
+		{
+			name: "every field",
+			filter: transactionFilter{
+				States:        []state{RETRY, FAILED},
+				Host:          "dummy:40691",
+				Method:        "POST",
+				OrderingKey:   "account-42",
+				CreatedAfter:  sql.NullTime{Time: createdAfter, Valid: true},
+				UpdatedBefore: sql.NullTime{Time: updatedBefore, Valid: true},
+			},
+			wantWhere: "TRUE AND state IN ($1, $2) AND host = $3 AND method = $4 AND ordering_key = $5 " +
+				"AND created_at >= $6 AND updated_at < $7",
+			wantArgs: []any{RETRY, FAILED, "dummy:40691", "POST", "account-42", createdAfter, updatedBefore},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			where, args := tt.filter.where(tt.args)
+			if where != tt.wantWhere {
+				t.Errorf("where() = %s, want %s", where, tt.wantWhere)
+			}
+			if !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Errorf("where() args = %v, want %v", args, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestToCountTransactionsResponse(t *testing.T) {
+	resp := toCountTransactionsResponse(map[state]int{RETRY: 3, FAILED: 2})
+
+	want := commons.CountTransactionsResponse{
+		Counts: map[string]int{"RETRY": 3, "FAILED": 2},
+		Total:  5,
+	}
+	if !reflect.DeepEqual(resp, want) {
+		t.Errorf("toCountTransactionsResponse() = %+v, want %+v", resp, want)
+	}
+}
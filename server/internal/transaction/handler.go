@@ -4,9 +4,15 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/mat-sik/sql-distributed-transactions/server/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/trace"
+	"io"
+	"mime"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
@@ -18,7 +24,7 @@ type EnqueueTransactionHandler struct {
 	repository Repository
 }
 
-func NewHandler(tracer trace.Tracer, repository Repository) EnqueueTransactionHandler {
+func NewEnqueueHandler(tracer trace.Tracer, repository Repository) EnqueueTransactionHandler {
 	return EnqueueTransactionHandler{
 		tracer:     tracer,
 		repository: repository,
@@ -34,12 +40,730 @@ func (h EnqueueTransactionHandler) ServeHTTP(w http.ResponseWriter, r *http.Requ
 
 	var req commons.EnqueueTransactionRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		handleErr(span, w, err, http.StatusInternalServerError, "Failed to unmarshal the request body")
+		handleErr(span, w, err, http.StatusBadRequest, "Failed to unmarshal the request body")
 		return
 	}
 
+	if req.IdempotencyKey == "" {
+		req.IdempotencyKey = r.Header.Get(commons.IdempotencyKeyHeader)
+	}
+
 	if err := commons.ValidRequest(req); err != nil {
-		handleErr(span, w, err, http.StatusInternalServerError, "Failed to validate the request")
+		handleErr(span, w, err, http.StatusBadRequest, "Failed to validate the request")
+		return
+	}
+
+	carrierJSON, err := tracing.MarshalContext(ctx)
+	if err != nil {
+		handleErr(span, w, err, http.StatusInternalServerError, "Failed to marshal the trace context")
+		return
+	}
+
+	createT, err := newCreateTransaction(req, carrierJSON)
+	if err != nil {
+		handleErr(span, w, err, http.StatusInternalServerError, "Failed to prepare the transaction")
+		return
+	}
+
+	span.AddEvent("Trying to enqueue the transaction")
+	id, created, err := h.repository.enqueueTransaction(ctx, createT)
+	if err != nil {
+		handleErr(span, w, err, http.StatusInternalServerError, "Failed to enqueue the transaction")
+		return
+	}
+
+	code := http.StatusCreated
+	if created {
+		span.AddEvent("Enqueued the transaction", trace.WithAttributes(
+			attribute.Int("transaction id", id),
+		))
+	} else {
+		code = http.StatusOK
+		span.AddEvent("Found an already enqueued transaction with the same idempotency key", trace.WithAttributes(
+			attribute.Int("transaction id", id),
+		))
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("/transactions/%d", id))
+	writeJSON(span, w, code, commons.EnqueueTransactionResponse{ID: id})
+}
+
+type EnqueueTransactionsHandler struct {
+	tracer     trace.Tracer
+	repository Repository
+}
+
+func NewEnqueueBatchHandler(tracer trace.Tracer, repository Repository) EnqueueTransactionsHandler {
+	return EnqueueTransactionsHandler{
+		tracer:     tracer,
+		repository: repository,
+	}
+}
+
+// ServeHTTP accepts either a JSON array, or a stream of newline delimited JSON objects when the content type is
+// application/x-ndjson. Invalid transactions are reported in their results, and do not prevent the valid ones from
+// being enqueued.
+func (h EnqueueTransactionsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	ctx, span := h.tracer.Start(ctx, "enqueueTransactionsHandler")
+	defer span.End()
+
+	reqs, err := decodeBatch(r)
+	if err != nil {
+		handleErr(span, w, err, http.StatusBadRequest, "Failed to unmarshal the request body")
+		return
+	}
+	if len(reqs) > commons.MaxBatchSize {
+		err = fmt.Errorf("batch must contain at most %d transactions", commons.MaxBatchSize)
+		handleErr(span, w, err, http.StatusBadRequest, "Failed to validate the request")
+		return
+	}
+
+	carrierJSON, err := tracing.MarshalContext(ctx)
+	if err != nil {
+		handleErr(span, w, err, http.StatusInternalServerError, "Failed to marshal the trace context")
+		return
+	}
+
+	results := make([]commons.EnqueueTransactionResult, len(reqs))
+	createTs := make([]createTransaction, 0, len(reqs))
+	positions := make([]int, 0, len(reqs))
+	for i, req := range reqs {
+		if err = commons.ValidRequest(req); err != nil {
+			results[i].Error = err.Error()
+			continue
+		}
+		createT, err := newCreateTransaction(req, carrierJSON)
+		if err != nil {
+			handleErr(span, w, err, http.StatusInternalServerError, "Failed to prepare the transaction")
+			return
+		}
+		createTs = append(createTs, createT)
+		positions = append(positions, i)
+	}
+
+	if len(createTs) > 0 {
+		span.AddEvent("Trying to enqueue the transactions", trace.WithAttributes(
+			attribute.Int("transaction count", len(createTs)),
+			attribute.Int("rejected count", len(reqs)-len(createTs)),
+		))
+		ids, created, err := h.repository.enqueueTransactions(ctx, createTs)
+		if err != nil {
+			handleErr(span, w, err, http.StatusInternalServerError, "Failed to enqueue the transactions")
+			return
+		}
+		for i, position := range positions {
+			results[position].ID = ids[i]
+			results[position].Created = created[i]
+		}
+		span.AddEvent("Enqueued the transactions")
+	}
+
+	writeJSON(span, w, http.StatusOK, commons.EnqueueTransactionsResponse{Results: results})
+}
+
+func decodeBatch(r *http.Request) ([]commons.EnqueueTransactionRequest, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != ndjsonContentType {
+		var reqs []commons.EnqueueTransactionRequest
+		err := json.NewDecoder(r.Body).Decode(&reqs)
+		return reqs, err
+	}
+
+	var reqs []commons.EnqueueTransactionRequest
+	decoder := json.NewDecoder(r.Body)
+	for {
+		var req commons.EnqueueTransactionRequest
+		err := decoder.Decode(&req)
+		if errors.Is(err, io.EOF) {
+			return reqs, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", len(reqs)+1, err)
+		}
+		if len(reqs) == commons.MaxBatchSize {
+			return nil, fmt.Errorf("batch must contain at most %d transactions", commons.MaxBatchSize)
+		}
+		reqs = append(reqs, req)
+	}
+}
+
+const ndjsonContentType = "application/x-ndjson"
+
+type GetTransactionHandler struct {
+	tracer     trace.Tracer
+	repository Repository
+}
+
+func NewGetHandler(tracer trace.Tracer, repository Repository) GetTransactionHandler {
+	return GetTransactionHandler{
+		tracer:     tracer,
+		repository: repository,
+	}
+}
+
+func (h GetTransactionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	ctx, span := h.tracer.Start(ctx, "getTransactionHandler")
+	defer span.End()
+
+	id, err := pathID(r)
+	if err != nil {
+		handleErr(span, w, err, http.StatusBadRequest, "Failed to parse the transaction id")
+		return
+	}
+
+	span.AddEvent("Trying to fetch the transaction", trace.WithAttributes(
+		attribute.Int("transaction id", id),
+	))
+	t, err := h.repository.fetchTransaction(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		handleErr(span, w, err, http.StatusNotFound, "Transaction not found")
+		return
+	}
+	if err != nil {
+		handleErr(span, w, err, http.StatusInternalServerError, "Failed to fetch the transaction")
+		return
+	}
+
+	writeJSON(span, w, http.StatusOK, t.toResponse())
+}
+
+type ListFailedTransactionsHandler struct {
+	tracer     trace.Tracer
+	repository Repository
+}
+
+func NewListFailedHandler(tracer trace.Tracer, repository Repository) ListFailedTransactionsHandler {
+	return ListFailedTransactionsHandler{
+		tracer:     tracer,
+		repository: repository,
+	}
+}
+
+func (h ListFailedTransactionsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	ctx, span := h.tracer.Start(ctx, "listFailedTransactionsHandler")
+	defer span.End()
+
+	afterID, err := queryInt(r, "after_id", 0)
+	if err != nil {
+		handleErr(span, w, err, http.StatusBadRequest, "Failed to parse the after_id parameter")
+		return
+	}
+
+	limit, err := queryLimit(r)
+	if err != nil {
+		handleErr(span, w, err, http.StatusBadRequest, "Failed to parse the limit parameter")
+		return
+	}
+
+	span.AddEvent("Trying to fetch the failed transactions")
+	transactions, err := h.repository.fetchFailedTransactions(ctx, afterID, limit)
+	if err != nil {
+		handleErr(span, w, err, http.StatusInternalServerError, "Failed to fetch the failed transactions")
+		return
+	}
+
+	resp := commons.ListTransactionsResponse{
+		Transactions: make([]commons.Transaction, 0, len(transactions)),
+	}
+	for _, t := range transactions {
+		resp.Transactions = append(resp.Transactions, t.toResponse())
+	}
+	writeJSON(span, w, http.StatusOK, resp)
+}
+
+type ListTransactionsHandler struct {
+	tracer     trace.Tracer
+	repository Repository
+}
+
+func NewListHandler(tracer trace.Tracer, repository Repository) ListTransactionsHandler {
+	return ListTransactionsHandler{
+		tracer:     tracer,
+		repository: repository,
+	}
+}
+
+func (h ListTransactionsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	ctx, span := h.tracer.Start(ctx, "listTransactionsHandler")
+	defer span.End()
+
+	filter, err := queryFilter(r)
+	if err != nil {
+		handleErr(span, w, err, http.StatusBadRequest, "Failed to parse the filter")
+		return
+	}
+
+	afterID, err := queryInt(r, "after_id", 0)
+	if err != nil {
+		handleErr(span, w, err, http.StatusBadRequest, "Failed to parse the after_id parameter")
+		return
+	}
+
+	limit, err := queryLimit(r)
+	if err != nil {
+		handleErr(span, w, err, http.StatusBadRequest, "Failed to parse the limit parameter")
+		return
+	}
+
+	span.AddEvent("Trying to fetch the transactions")
+	transactions, err := h.repository.fetchTransactions(ctx, filter, afterID, limit)
+	if err != nil {
+		handleErr(span, w, err, http.StatusInternalServerError, "Failed to fetch the transactions")
+		return
+	}
+
+	resp := commons.ListTransactionsResponse{
+		Transactions: make([]commons.Transaction, 0, len(transactions)),
+	}
+	for _, t := range transactions {
+		resp.Transactions = append(resp.Transactions, t.toResponse())
+	}
+	if len(transactions) == limit {
+		resp.NextAfterID = transactions[len(transactions)-1].ID
+	}
+	writeJSON(span, w, http.StatusOK, resp)
+}
+
+type CountTransactionsHandler struct {
+	tracer     trace.Tracer
+	repository Repository
+}
+
+func NewCountHandler(tracer trace.Tracer, repository Repository) CountTransactionsHandler {
+	return CountTransactionsHandler{
+		tracer:     tracer,
+		repository: repository,
+	}
+}
+
+func (h CountTransactionsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	ctx, span := h.tracer.Start(ctx, "countTransactionsHandler")
+	defer span.End()
+
+	filter, err := queryFilter(r)
+	if err != nil {
+		handleErr(span, w, err, http.StatusBadRequest, "Failed to parse the filter")
+		return
+	}
+
+	span.AddEvent("Trying to count the transactions")
+	counts, err := h.repository.countTransactions(ctx, filter)
+	if err != nil {
+		handleErr(span, w, err, http.StatusInternalServerError, "Failed to count the transactions")
+		return
+	}
+
+	writeJSON(span, w, http.StatusOK, toCountTransactionsResponse(counts))
+}
+
+type RequeueTransactionHandler struct {
+	tracer     trace.Tracer
+	repository Repository
+}
+
+func NewRequeueHandler(tracer trace.Tracer, repository Repository) RequeueTransactionHandler {
+	return RequeueTransactionHandler{
+		tracer:     tracer,
+		repository: repository,
+	}
+}
+
+func (h RequeueTransactionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	ctx, span := h.tracer.Start(ctx, "requeueTransactionHandler")
+	defer span.End()
+
+	id, err := pathID(r)
+	if err != nil {
+		handleErr(span, w, err, http.StatusBadRequest, "Failed to parse the transaction id")
+		return
+	}
+
+	span.AddEvent("Trying to requeue the transaction", trace.WithAttributes(
+		attribute.Int("transaction id", id),
+	))
+	err = h.repository.requeueFailedTransaction(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		handleErr(span, w, err, http.StatusNotFound, "Transaction not found")
+		return
+	}
+	if errors.Is(err, errInvalidState) {
+		handleErr(span, w, err, http.StatusConflict, "Transaction is not dead-lettered")
+		return
+	}
+	if err != nil {
+		handleErr(span, w, err, http.StatusInternalServerError, "Failed to requeue the transaction")
+		return
+	}
+
+	t, err := h.repository.fetchTransaction(ctx, id)
+	if err != nil {
+		handleErr(span, w, err, http.StatusInternalServerError, "Failed to fetch the transaction")
+		return
+	}
+
+	span.AddEvent("Requeued the transaction")
+	writeJSON(span, w, http.StatusOK, t.toResponse())
+}
+
+type CancelTransactionHandler struct {
+	tracer     trace.Tracer
+	repository Repository
+}
+
+func NewCancelHandler(tracer trace.Tracer, repository Repository) CancelTransactionHandler {
+	return CancelTransactionHandler{
+		tracer:     tracer,
+		repository: repository,
+	}
+}
+
+func (h CancelTransactionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	ctx, span := h.tracer.Start(ctx, "cancelTransactionHandler")
+	defer span.End()
+
+	id, err := pathID(r)
+	if err != nil {
+		handleErr(span, w, err, http.StatusBadRequest, "Failed to parse the transaction id")
+		return
+	}
+
+	span.AddEvent("Trying to cancel the transaction", trace.WithAttributes(
+		attribute.Int("transaction id", id),
+	))
+	err = h.repository.cancelTransaction(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		handleErr(span, w, err, http.StatusNotFound, "Transaction not found")
+		return
+	}
+	if errors.Is(err, errInvalidState) {
+		handleErr(span, w, err, http.StatusConflict, "Transaction is no longer waiting to be sent")
+		return
+	}
+	if err != nil {
+		handleErr(span, w, err, http.StatusInternalServerError, "Failed to cancel the transaction")
+		return
+	}
+
+	t, err := h.repository.fetchTransaction(ctx, id)
+	if err != nil {
+		handleErr(span, w, err, http.StatusInternalServerError, "Failed to fetch the transaction")
+		return
+	}
+
+	span.AddEvent("Cancelled the transaction")
+	writeJSON(span, w, http.StatusOK, t.toResponse())
+}
+
+type ReplayTransactionsHandler struct {
+	tracer     trace.Tracer
+	repository Repository
+}
+
+func NewReplayHandler(tracer trace.Tracer, repository Repository) ReplayTransactionsHandler {
+	return ReplayTransactionsHandler{
+		tracer:     tracer,
+		repository: repository,
+	}
+}
+
+func (h ReplayTransactionsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	ctx, span := h.tracer.Start(ctx, "replayTransactionsHandler")
+	defer span.End()
+
+	var req commons.ReplayTransactionsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		handleErr(span, w, err, http.StatusBadRequest, "Failed to unmarshal the request body")
+		return
+	}
+
+	if err := commons.ValidReplayRequest(req); err != nil {
+		handleErr(span, w, err, http.StatusBadRequest, "Failed to validate the request")
+		return
+	}
+
+	var filter transactionFilter
+	if req.Filter != nil {
+		var err error
+		if filter, err = newTransactionFilter(*req.Filter); err != nil {
+			handleErr(span, w, err, http.StatusBadRequest, "Failed to validate the filter")
+			return
+		}
+	}
+	filter.IDs = req.IDs
+
+	if req.DryRun {
+		span.AddEvent("Trying to count the replayable transactions")
+		matched, err := h.repository.countReplayableTransactions(ctx, filter, req.AfterID)
+		if err != nil {
+			handleErr(span, w, err, http.StatusInternalServerError, "Failed to count the replayable transactions")
+			return
+		}
+		writeJSON(span, w, http.StatusOK, commons.ReplayTransactionsResponse{
+			Matched:        matched,
+			TransactionIDs: []int{},
+		})
+		return
+	}
+
+	mode := req.Mode
+	if mode == "" {
+		mode = commons.ReplayModeReset
+	}
+	limit := req.Limit
+	if limit == 0 {
+		limit = defaultListLimit
+	}
+
+	span.AddEvent("Trying to replay the transactions", trace.WithAttributes(
+		attribute.String("mode", mode),
+		attribute.Int("after id", req.AfterID),
+		attribute.Int("limit", limit),
+	))
+	ids, lastMatchedID, err := h.repository.replayTransactions(ctx, filter, mode, req.AfterID, limit)
+	if err != nil {
+		handleErr(span, w, err, http.StatusInternalServerError, "Failed to replay the transactions")
+		return
+	}
+	span.AddEvent("Replayed the transactions", trace.WithAttributes(
+		attribute.Int("transaction count", len(ids)),
+	))
+
+	resp := commons.ReplayTransactionsResponse{
+		Matched:        len(ids),
+		TransactionIDs: make([]int, 0, len(ids)),
+	}
+	resp.TransactionIDs = append(resp.TransactionIDs, ids...)
+	if len(ids) == limit {
+		resp.NextAfterID = lastMatchedID
+	}
+	writeJSON(span, w, http.StatusOK, resp)
+}
+
+type ListCircuitBreakersHandler struct {
+	tracer   trace.Tracer
+	breakers *CircuitBreakers
+}
+
+func NewListCircuitBreakersHandler(tracer trace.Tracer, breakers *CircuitBreakers) ListCircuitBreakersHandler {
+	return ListCircuitBreakersHandler{
+		tracer:   tracer,
+		breakers: breakers,
+	}
+}
+
+func (h ListCircuitBreakersHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	_, span := h.tracer.Start(r.Context(), "listCircuitBreakersHandler")
+	defer span.End()
+
+	writeJSON(span, w, http.StatusOK, commons.ListCircuitBreakersResponse{
+		CircuitBreakers: h.breakers.snapshot(),
+	})
+}
+
+type ListTransactionAttemptsHandler struct {
+	tracer     trace.Tracer
+	repository Repository
+}
+
+func NewListAttemptsHandler(tracer trace.Tracer, repository Repository) ListTransactionAttemptsHandler {
+	return ListTransactionAttemptsHandler{
+		tracer:     tracer,
+		repository: repository,
+	}
+}
+
+func (h ListTransactionAttemptsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	ctx, span := h.tracer.Start(ctx, "listTransactionAttemptsHandler")
+	defer span.End()
+
+	id, err := pathID(r)
+	if err != nil {
+		handleErr(span, w, err, http.StatusBadRequest, "Failed to parse the transaction id")
+		return
+	}
+
+	span.AddEvent("Trying to fetch the transaction", trace.WithAttributes(
+		attribute.Int("transaction id", id),
+	))
+	_, err = h.repository.fetchTransaction(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		handleErr(span, w, err, http.StatusNotFound, "Transaction not found")
+		return
+	}
+	if err != nil {
+		handleErr(span, w, err, http.StatusInternalServerError, "Failed to fetch the transaction")
+		return
+	}
+
+	span.AddEvent("Trying to fetch the transaction attempts")
+	attempts, err := h.repository.fetchTransactionAttempts(ctx, id)
+	if err != nil {
+		handleErr(span, w, err, http.StatusInternalServerError, "Failed to fetch the transaction attempts")
+		return
+	}
+
+	resp := commons.ListTransactionAttemptsResponse{
+		Attempts: make([]commons.TransactionAttempt, 0, len(attempts)),
+	}
+	for _, a := range attempts {
+		resp.Attempts = append(resp.Attempts, a.toResponse())
+	}
+	writeJSON(span, w, http.StatusOK, resp)
+}
+
+type EnqueueSagaHandler struct {
+	tracer     trace.Tracer
+	repository Repository
+}
+
+func NewEnqueueSagaHandler(tracer trace.Tracer, repository Repository) EnqueueSagaHandler {
+	return EnqueueSagaHandler{
+		tracer:     tracer,
+		repository: repository,
+	}
+}
+
+func (h EnqueueSagaHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	ctx, span := h.tracer.Start(ctx, "enqueueSagaHandler")
+	defer span.End()
+
+	var req commons.EnqueueSagaRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		handleErr(span, w, err, http.StatusBadRequest, "Failed to unmarshal the request body")
+		return
+	}
+
+	if err := commons.ValidSagaRequest(req); err != nil {
+		handleErr(span, w, err, http.StatusBadRequest, "Failed to validate the request")
+		return
+	}
+
+	carrierJSON, err := tracing.MarshalContext(ctx)
+	if err != nil {
+		handleErr(span, w, err, http.StatusInternalServerError, "Failed to marshal the trace context")
+		return
+	}
+
+	createS, err := newCreateSaga(req, carrierJSON)
+	if err != nil {
+		handleErr(span, w, err, http.StatusInternalServerError, "Failed to prepare the saga")
+		return
+	}
+
+	span.AddEvent("Trying to enqueue the saga", trace.WithAttributes(
+		attribute.Int("steps", len(createS.Steps)),
+	))
+	id, err := h.repository.createSaga(ctx, createS)
+	if err != nil {
+		handleErr(span, w, err, http.StatusInternalServerError, "Failed to enqueue the saga")
+		return
+	}
+	span.AddEvent("Enqueued the saga", trace.WithAttributes(
+		attribute.Int("saga id", id),
+	))
+
+	w.Header().Set("Location", fmt.Sprintf("/sagas/%d", id))
+	writeJSON(span, w, http.StatusCreated, commons.EnqueueSagaResponse{ID: id})
+}
+
+type GetSagaHandler struct {
+	tracer     trace.Tracer
+	repository Repository
+}
+
+func NewGetSagaHandler(tracer trace.Tracer, repository Repository) GetSagaHandler {
+	return GetSagaHandler{
+		tracer:     tracer,
+		repository: repository,
+	}
+}
+
+func (h GetSagaHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	ctx, span := h.tracer.Start(ctx, "getSagaHandler")
+	defer span.End()
+
+	id, err := pathID(r)
+	if err != nil {
+		handleErr(span, w, err, http.StatusBadRequest, "Failed to parse the saga id")
+		return
+	}
+
+	span.AddEvent("Trying to fetch the saga", trace.WithAttributes(
+		attribute.Int("saga id", id),
+	))
+	saga, err := h.repository.fetchSaga(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		handleErr(span, w, err, http.StatusNotFound, "Saga not found")
+		return
+	}
+	if err != nil {
+		handleErr(span, w, err, http.StatusInternalServerError, "Failed to fetch the saga")
+		return
+	}
+
+	writeJSON(span, w, http.StatusOK, saga.toResponse())
+}
+
+type EnqueueTwoPhaseCommitHandler struct {
+	tracer     trace.Tracer
+	repository Repository
+}
+
+func NewEnqueueTwoPhaseCommitHandler(tracer trace.Tracer, repository Repository) EnqueueTwoPhaseCommitHandler {
+	return EnqueueTwoPhaseCommitHandler{
+		tracer:     tracer,
+		repository: repository,
+	}
+}
+
+func (h EnqueueTwoPhaseCommitHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	ctx, span := h.tracer.Start(ctx, "enqueueTwoPhaseCommitHandler")
+	defer span.End()
+
+	var req commons.EnqueueTwoPhaseCommitRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		handleErr(span, w, err, http.StatusBadRequest, "Failed to unmarshal the request body")
+		return
+	}
+
+	if err := commons.ValidTwoPhaseCommitRequest(req); err != nil {
+		handleErr(span, w, err, http.StatusBadRequest, "Failed to validate the request")
 		return
 	}
 
@@ -49,7 +773,346 @@ func (h EnqueueTransactionHandler) ServeHTTP(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	createT := createTransaction{
+	createC, err := newCreateTwoPhaseCommit(req, carrierJSON)
+	if err != nil {
+		handleErr(span, w, err, http.StatusInternalServerError, "Failed to prepare the two-phase commit")
+		return
+	}
+
+	span.AddEvent("Trying to enqueue the two-phase commit", trace.WithAttributes(
+		attribute.Int("participants", len(createC.Participants)),
+	))
+	id, err := h.repository.createTwoPhaseCommit(ctx, createC)
+	if err != nil {
+		handleErr(span, w, err, http.StatusInternalServerError, "Failed to enqueue the two-phase commit")
+		return
+	}
+	span.AddEvent("Enqueued the two-phase commit", trace.WithAttributes(
+		attribute.Int("two-phase commit id", id),
+	))
+
+	w.Header().Set("Location", fmt.Sprintf("/two-phase-commits/%d", id))
+	writeJSON(span, w, http.StatusCreated, commons.EnqueueTwoPhaseCommitResponse{ID: id})
+}
+
+type GetTwoPhaseCommitHandler struct {
+	tracer     trace.Tracer
+	repository Repository
+}
+
+func NewGetTwoPhaseCommitHandler(tracer trace.Tracer, repository Repository) GetTwoPhaseCommitHandler {
+	return GetTwoPhaseCommitHandler{
+		tracer:     tracer,
+		repository: repository,
+	}
+}
+
+func (h GetTwoPhaseCommitHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	ctx, span := h.tracer.Start(ctx, "getTwoPhaseCommitHandler")
+	defer span.End()
+
+	id, err := pathID(r)
+	if err != nil {
+		handleErr(span, w, err, http.StatusBadRequest, "Failed to parse the two-phase commit id")
+		return
+	}
+
+	span.AddEvent("Trying to fetch the two-phase commit", trace.WithAttributes(
+		attribute.Int("two-phase commit id", id),
+	))
+	commit, err := h.repository.fetchTwoPhaseCommit(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		handleErr(span, w, err, http.StatusNotFound, "Two-phase commit not found")
+		return
+	}
+	if err != nil {
+		handleErr(span, w, err, http.StatusInternalServerError, "Failed to fetch the two-phase commit")
+		return
+	}
+
+	writeJSON(span, w, http.StatusOK, commit.toResponse())
+}
+
+type CreateRecurringTransactionHandler struct {
+	tracer     trace.Tracer
+	repository Repository
+}
+
+func NewCreateRecurringHandler(tracer trace.Tracer, repository Repository) CreateRecurringTransactionHandler {
+	return CreateRecurringTransactionHandler{
+		tracer:     tracer,
+		repository: repository,
+	}
+}
+
+func (h CreateRecurringTransactionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	ctx, span := h.tracer.Start(ctx, "createRecurringTransactionHandler")
+	defer span.End()
+
+	upsert, err := decodeRecurringTransaction(r)
+	if err != nil {
+		handleErr(span, w, err, http.StatusBadRequest, "Failed to read the recurring transaction")
+		return
+	}
+
+	span.AddEvent("Trying to create the recurring transaction")
+	t, err := h.repository.createRecurringTransaction(ctx, upsert)
+	if err != nil {
+		handleErr(span, w, err, http.StatusInternalServerError, "Failed to create the recurring transaction")
+		return
+	}
+	span.AddEvent("Created the recurring transaction", trace.WithAttributes(
+		attribute.Int("recurring transaction id", t.ID),
+	))
+
+	w.Header().Set("Location", fmt.Sprintf("/recurring-transactions/%d", t.ID))
+	writeRecurringTransaction(span, w, http.StatusCreated, t)
+}
+
+type GetRecurringTransactionHandler struct {
+	tracer     trace.Tracer
+	repository Repository
+}
+
+func NewGetRecurringHandler(tracer trace.Tracer, repository Repository) GetRecurringTransactionHandler {
+	return GetRecurringTransactionHandler{
+		tracer:     tracer,
+		repository: repository,
+	}
+}
+
+func (h GetRecurringTransactionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	ctx, span := h.tracer.Start(ctx, "getRecurringTransactionHandler")
+	defer span.End()
+
+	id, err := pathID(r)
+	if err != nil {
+		handleErr(span, w, err, http.StatusBadRequest, "Failed to parse the recurring transaction id")
+		return
+	}
+
+	span.AddEvent("Trying to fetch the recurring transaction", trace.WithAttributes(
+		attribute.Int("recurring transaction id", id),
+	))
+	t, err := h.repository.fetchRecurringTransaction(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		handleErr(span, w, err, http.StatusNotFound, "Recurring transaction not found")
+		return
+	}
+	if err != nil {
+		handleErr(span, w, err, http.StatusInternalServerError, "Failed to fetch the recurring transaction")
+		return
+	}
+
+	writeRecurringTransaction(span, w, http.StatusOK, t)
+}
+
+type ListRecurringTransactionsHandler struct {
+	tracer     trace.Tracer
+	repository Repository
+}
+
+func NewListRecurringHandler(tracer trace.Tracer, repository Repository) ListRecurringTransactionsHandler {
+	return ListRecurringTransactionsHandler{
+		tracer:     tracer,
+		repository: repository,
+	}
+}
+
+func (h ListRecurringTransactionsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	ctx, span := h.tracer.Start(ctx, "listRecurringTransactionsHandler")
+	defer span.End()
+
+	afterID, err := queryInt(r, "after_id", 0)
+	if err != nil {
+		handleErr(span, w, err, http.StatusBadRequest, "Failed to parse the after_id parameter")
+		return
+	}
+	limit, err := queryLimit(r)
+	if err != nil {
+		handleErr(span, w, err, http.StatusBadRequest, "Failed to parse the limit parameter")
+		return
+	}
+
+	span.AddEvent("Trying to fetch the recurring transactions", trace.WithAttributes(
+		attribute.Int("after id", afterID),
+		attribute.Int("limit", limit),
+	))
+	transactions, err := h.repository.fetchRecurringTransactions(ctx, afterID, limit)
+	if err != nil {
+		handleErr(span, w, err, http.StatusInternalServerError, "Failed to fetch the recurring transactions")
+		return
+	}
+
+	resp := commons.ListRecurringTransactionsResponse{
+		RecurringTransactions: make([]commons.RecurringTransaction, 0, len(transactions)),
+	}
+	for _, t := range transactions {
+		tResp, err := t.toResponse()
+		if err != nil {
+			handleErr(span, w, err, http.StatusInternalServerError, "Failed to read the recurring transaction")
+			return
+		}
+		resp.RecurringTransactions = append(resp.RecurringTransactions, tResp)
+	}
+	writeJSON(span, w, http.StatusOK, resp)
+}
+
+type ReplaceRecurringTransactionHandler struct {
+	tracer     trace.Tracer
+	repository Repository
+}
+
+func NewReplaceRecurringHandler(tracer trace.Tracer, repository Repository) ReplaceRecurringTransactionHandler {
+	return ReplaceRecurringTransactionHandler{
+		tracer:     tracer,
+		repository: repository,
+	}
+}
+
+func (h ReplaceRecurringTransactionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	ctx, span := h.tracer.Start(ctx, "replaceRecurringTransactionHandler")
+	defer span.End()
+
+	id, err := pathID(r)
+	if err != nil {
+		handleErr(span, w, err, http.StatusBadRequest, "Failed to parse the recurring transaction id")
+		return
+	}
+
+	upsert, err := decodeRecurringTransaction(r)
+	if err != nil {
+		handleErr(span, w, err, http.StatusBadRequest, "Failed to read the recurring transaction")
+		return
+	}
+
+	span.AddEvent("Trying to replace the recurring transaction", trace.WithAttributes(
+		attribute.Int("recurring transaction id", id),
+	))
+	t, err := h.repository.replaceRecurringTransaction(ctx, id, upsert)
+	if errors.Is(err, sql.ErrNoRows) {
+		handleErr(span, w, err, http.StatusNotFound, "Recurring transaction not found")
+		return
+	}
+	if err != nil {
+		handleErr(span, w, err, http.StatusInternalServerError, "Failed to replace the recurring transaction")
+		return
+	}
+
+	writeRecurringTransaction(span, w, http.StatusOK, t)
+}
+
+type DeleteRecurringTransactionHandler struct {
+	tracer     trace.Tracer
+	repository Repository
+}
+
+func NewDeleteRecurringHandler(tracer trace.Tracer, repository Repository) DeleteRecurringTransactionHandler {
+	return DeleteRecurringTransactionHandler{
+		tracer:     tracer,
+		repository: repository,
+	}
+}
+
+func (h DeleteRecurringTransactionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	ctx, span := h.tracer.Start(ctx, "deleteRecurringTransactionHandler")
+	defer span.End()
+
+	id, err := pathID(r)
+	if err != nil {
+		handleErr(span, w, err, http.StatusBadRequest, "Failed to parse the recurring transaction id")
+		return
+	}
+
+	span.AddEvent("Trying to delete the recurring transaction", trace.WithAttributes(
+		attribute.Int("recurring transaction id", id),
+	))
+	err = h.repository.deleteRecurringTransaction(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		handleErr(span, w, err, http.StatusNotFound, "Recurring transaction not found")
+		return
+	}
+	if err != nil {
+		handleErr(span, w, err, http.StatusInternalServerError, "Failed to delete the recurring transaction")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func decodeRecurringTransaction(r *http.Request) (upsertRecurringTransaction, error) {
+	var req commons.RecurringTransactionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return upsertRecurringTransaction{}, err
+	}
+	if err := commons.ValidRecurringTransactionRequest(req); err != nil {
+		return upsertRecurringTransaction{}, err
+	}
+	return newUpsertRecurringTransaction(req, time.Now())
+}
+
+func writeRecurringTransaction(span trace.Span, w http.ResponseWriter, code int, t recurringTransaction) {
+	resp, err := t.toResponse()
+	if err != nil {
+		handleErr(span, w, err, http.StatusInternalServerError, "Failed to read the recurring transaction")
+		return
+	}
+	writeJSON(span, w, code, resp)
+}
+
+func newCreateTransaction(req commons.EnqueueTransactionRequest, carrierJSON string) (createTransaction, error) {
+	var responsePolicyJSON sql.NullString
+	if req.RetryOn != nil || req.FailOn != nil {
+		encoded, err := json.Marshal(responsePolicy{
+			RetryOn: req.RetryOn,
+			FailOn:  req.FailOn,
+		})
+		if err != nil {
+			return createTransaction{}, err
+		}
+		responsePolicyJSON = sql.NullString{
+			String: string(encoded),
+			Valid:  true,
+		}
+	}
+
+	var headersJSON sql.NullString
+	if len(req.Headers) > 0 {
+		encoded, err := json.Marshal(req.Headers)
+		if err != nil {
+			return createTransaction{}, err
+		}
+		headersJSON = sql.NullString{
+			String: string(encoded),
+			Valid:  true,
+		}
+	}
+
+	scheme := strings.ToLower(req.Scheme)
+	if scheme == "" {
+		scheme = "http"
+	}
+
+	return createTransaction{
+		Scheme: scheme,
 		Host:   req.Host,
 		Path:   req.Path,
 		Method: strings.ToUpper(req.Method),
@@ -57,19 +1120,88 @@ func (h EnqueueTransactionHandler) ServeHTTP(w http.ResponseWriter, r *http.Requ
 			String: req.Payload,
 			Valid:  req.Payload != "",
 		},
+		IdempotencyKey: sql.NullString{
+			String: req.IdempotencyKey,
+			Valid:  req.IdempotencyKey != "",
+		},
+		OrderingKey: sql.NullString{
+			String: req.OrderingKey,
+			Valid:  req.OrderingKey != "",
+		},
+		Priority:  req.Priority,
+		NotBefore: toNullTime(req.NotBefore),
+		Delay:     time.Duration(req.Delay),
+		ExpiresAt: toNullTime(req.ExpiresAt),
+		TTL:       time.Duration(req.TTL),
+		MaxAttempts: sql.NullInt32{
+			Int32: int32(req.MaxAttempts),
+			Valid: req.MaxAttempts > 0,
+		},
+		ResponsePolicy: responsePolicyJSON,
+		Headers:        headersJSON,
+		ContentType: sql.NullString{
+			String: req.ContentType,
+			Valid:  req.ContentType != "",
+		},
 		carrierJSON: carrierJSON,
+	}, nil
+}
+
+func toNullTime(t *time.Time) sql.NullTime {
+	if t == nil {
+		return sql.NullTime{}
 	}
+	return sql.NullTime{
+		Time:  *t,
+		Valid: true,
+	}
+}
 
-	span.AddEvent("Trying to enqueue the transaction")
-	if err = h.repository.enqueueTransaction(ctx, createT); err != nil {
-		handleErr(span, w, err, http.StatusInternalServerError, "Failed to enqueue the transaction")
-		return
+func pathID(r *http.Request) (int, error) {
+	return strconv.Atoi(r.PathValue("id"))
+}
+
+func queryInt(r *http.Request, name string, defaultValue int) (int, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return defaultValue, nil
+	}
+	return strconv.Atoi(value)
+}
+
+func queryFilter(r *http.Request) (transactionFilter, error) {
+	filter, err := commons.ParseListTransactionsFilter(r.URL.Query())
+	if err != nil {
+		return transactionFilter{}, err
+	}
+	return newTransactionFilter(filter)
+}
+
+func queryLimit(r *http.Request) (int, error) {
+	limit, err := queryInt(r, "limit", defaultListLimit)
+	if err != nil {
+		return 0, err
+	}
+	if limit <= 0 || limit > maxListLimit {
+		return 0, fmt.Errorf("limit must be between 1 and %d", maxListLimit)
 	}
+	return limit, nil
+}
 
-	span.AddEvent("Enqueued the transaction")
+func writeJSON(span trace.Span, w http.ResponseWriter, code int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		tracing.RecordErr(span, err, "Failed to marshal the response body")
+	}
 }
 
 func handleErr(span trace.Span, w http.ResponseWriter, err error, code int, description string, options ...trace.EventOption) {
 	tracing.RecordErr(span, err, description, options...)
 	http.Error(w, err.Error(), code)
 }
+
+const (
+	defaultListLimit = 100
+	maxListLimit     = 1000
+)
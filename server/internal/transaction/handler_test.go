@@ -0,0 +1,512 @@
+package transaction
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	commons "github.com/mat-sik/sql-distributed-transactions/common/transaction"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+func TestQueryLimit(t *testing.T) {
+	tests := []struct {
+		name    string
+		target  string
+		want    int
+		wantErr bool
+	}{
+		{name: "default", target: "/transactions", want: defaultListLimit},
+		{name: "given", target: "/transactions?limit=50", want: 50},
+		{name: "maximum", target: "/transactions?limit=1000", want: maxListLimit},
+		{name: "above the maximum", target: "/transactions?limit=1001", wantErr: true},
+		{name: "zero", target: "/transactions?limit=0", wantErr: true},
+		{name: "not a number", target: "/transactions?limit=ten", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := queryLimit(httptest.NewRequest("GET", tt.target, nil))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("queryLimit() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("queryLimit() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewCreateTransaction(t *testing.T) {
+	tests := []struct {
+		name            string
+		req             commons.EnqueueTransactionRequest
+		wantOrderingKey sql.NullString
+		wantMaxAttempts sql.NullInt32
+	}{
+		{
+			name: "defaults",
+			req:  commons.EnqueueTransactionRequest{Host: "dummy:40691", Path: "/transactions", Method: "post"},
+		},
+		{
+			name: "ordering key and max attempts",
+			req: commons.EnqueueTransactionRequest{
+				Host:        "dummy:40691",
+				Path:        "/transactions",
+				Method:      "post",
+				OrderingKey: "account-42",
+				MaxAttempts: 3,
+			},
+			wantOrderingKey: sql.NullString{String: "account-42", Valid: true},
+			wantMaxAttempts: sql.NullInt32{Int32: 3, Valid: true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			createT, err := newCreateTransaction(tt.req, "{}")
+			if err != nil {
+				t.Fatalf("newCreateTransaction() error = %v", err)
+			}
+			if createT.Method != "POST" {
+				t.Errorf("newCreateTransaction() method = %s, want POST", createT.Method)
+			}
+			if createT.OrderingKey != tt.wantOrderingKey {
+				t.Errorf("newCreateTransaction() ordering key = %v, want %v", createT.OrderingKey, tt.wantOrderingKey)
+			}
+			if createT.MaxAttempts != tt.wantMaxAttempts {
+				t.Errorf("newCreateTransaction() max attempts = %v, want %v", createT.MaxAttempts, tt.wantMaxAttempts)
+			}
+		})
+	}
+}
+
+func TestDecodeBatch(t *testing.T) {
+	tooLong := strings.Repeat(`{"host": "dummy:40691"}`+"\n", commons.MaxBatchSize+1)
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		wantHosts   []string
+		wantErr     bool
+	}{
+		{
+			name:        "JSON array",
+			contentType: "application/json",
+			body:        `[{"host": "a"}, {"host": "b"}]`,
+			wantHosts:   []string{"a", "b"},
+		},
+		{
+			name:        "newline delimited JSON",
+			contentType: "application/x-ndjson; charset=utf-8",
+			body:        "{\"host\": \"a\"}\n{\"host\": \"b\"}\n",
+			wantHosts:   []string{"a", "b"},
+		},
+		{
+			name:        "malformed line",
+			contentType: ndjsonContentType,
+			body:        "{\"host\": \"a\"}\n{\"host\":\n",
+			wantErr:     true,
+		},
+		{
+			name:        "too many lines",
+			contentType: ndjsonContentType,
+			body:        tooLong,
+			wantErr:     true,
+		},
+		{
+			name:        "object instead of an array",
+			contentType: "application/json",
+			body:        `{"host": "a"}`,
+			wantErr:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/transactions/batch", strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", tt.contentType)
+
+			reqs, err := decodeBatch(r)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("decodeBatch() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			hosts := make([]string, 0, len(reqs))
+			for _, req := range reqs {
+				hosts = append(hosts, req.Host)
+			}
+			if !tt.wantErr && !slices.Equal(hosts, tt.wantHosts) {
+				t.Errorf("decodeBatch() hosts = %v, want %v", hosts, tt.wantHosts)
+			}
+		})
+	}
+}
+
+// enqueueRepository enqueues the transaction with ID 2, unless its idempotency key is taken by the transaction with ID
+// 1.
+type enqueueRepository struct {
+	Repository
+	takenKey string
+}
+
+func (r *enqueueRepository) enqueueTransaction(_ context.Context, createTransaction createTransaction) (int, bool, error) {
+	if createTransaction.IdempotencyKey.String == r.takenKey {
+		return 1, false, nil
+	}
+	return 2, true, nil
+}
+
+func TestEnqueueTransactionHandler(t *testing.T) {
+	tests := []struct {
+		name         string
+		body         string
+		wantCode     int
+		wantLocation string
+	}{
+		{
+			name:         "created",
+			body:         `{"host": "dummy:40691", "path": "/transactions", "method": "POST"}`,
+			wantCode:     http.StatusCreated,
+			wantLocation: "/transactions/2",
+		},
+		{
+			name:         "duplicate",
+			body:         `{"host": "dummy:40691", "path": "/transactions", "method": "POST", "idempotency_key": "taken"}`,
+			wantCode:     http.StatusOK,
+			wantLocation: "/transactions/1",
+		},
+		{
+			name:     "malformed body",
+			body:     `{"host": "dummy:40691",`,
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "invalid request",
+			body:     `{"host": "dummy:40691", "path": "/transactions", "method": "FETCH"}`,
+			wantCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewEnqueueHandler(noop.NewTracerProvider().Tracer(""), &enqueueRepository{takenKey: "taken"})
+			w := httptest.NewRecorder()
+
+			h.ServeHTTP(w, httptest.NewRequest("POST", "/transactions/enqueue", strings.NewReader(tt.body)))
+			if w.Code != tt.wantCode {
+				t.Errorf("ServeHTTP() status = %d, want %d", w.Code, tt.wantCode)
+			}
+			if location := w.Header().Get("Location"); location != tt.wantLocation {
+				t.Errorf("ServeHTTP() location = %q, want %q", location, tt.wantLocation)
+			}
+		})
+	}
+}
+
+// batchRepository enqueues every transaction with the next ID, except the ones whose idempotency key is taken.
+type batchRepository struct {
+	Repository
+	takenKey string
+	enqueued []createTransaction
+}
+
+func (r *batchRepository) enqueueTransactions(_ context.Context, createTransactions []createTransaction) ([]int, []bool, error) {
+	ids := make([]int, len(createTransactions))
+	created := make([]bool, len(createTransactions))
+	for i, createT := range createTransactions {
+		if createT.IdempotencyKey.String == r.takenKey {
+			ids[i] = 1
+			continue
+		}
+		r.enqueued = append(r.enqueued, createT)
+		ids[i] = len(r.enqueued) + 1
+		created[i] = true
+	}
+	return ids, created, nil
+}
+
+func TestEnqueueTransactionsHandlerReportsEachResult(t *testing.T) {
+	repository := &batchRepository{takenKey: "taken"}
+	h := NewEnqueueBatchHandler(noop.NewTracerProvider().Tracer(""), repository)
+
+	body := `[
+		{"host": "dummy:40691", "path": "/transactions", "method": "POST"},
+		{"host": "dummy:40691", "path": "/transactions", "method": "FETCH"},
+		{"host": "dummy:40691", "path": "/transactions", "method": "POST", "idempotency_key": "taken"},
+		{"host": "dummy:40691", "path": "/transactions", "method": "PUT"}
+	]`
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("POST", "/transactions/batch", strings.NewReader(body)))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("ServeHTTP() status = %d, want %d", w.Code, http.StatusOK)
+	}
+	var resp commons.EnqueueTransactionsResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode the response: %v", err)
+	}
+
+	want := []struct {
+		id      int
+		created bool
+		failed  bool
+	}{
+		{id: 2, created: true},
+		{failed: true},
+		{id: 1},
+		{id: 3, created: true},
+	}
+	if len(resp.Results) != len(want) {
+		t.Fatalf("ServeHTTP() returned %d results, want %d", len(resp.Results), len(want))
+	}
+	for i, result := range resp.Results {
+		got := fmt.Sprintf("%d %v %v", result.ID, result.Created, result.Error != "")
+		if expected := fmt.Sprintf("%d %v %v", want[i].id, want[i].created, want[i].failed); got != expected {
+			t.Errorf("result %d = %+v, want id, created and failed %s", i, result, expected)
+		}
+	}
+	if len(repository.enqueued) != 2 {
+		t.Errorf("ServeHTTP() enqueued %d transactions, want the 2 valid ones which are not duplicates", len(repository.enqueued))
+	}
+}
+
+// cancelRepository fails the cancellation with err, and leaves every other method of the Repository unimplemented.
+type cancelRepository struct {
+	Repository
+	err error
+}
+
+func (r cancelRepository) cancelTransaction(context.Context, int) error {
+	return r.err
+}
+
+func (r cancelRepository) fetchTransaction(_ context.Context, id int) (transactionStatus, error) {
+	return transactionStatus{ID: id, State: CANCELLED}, nil
+}
+
+func TestCancelTransactionHandler(t *testing.T) {
+	tests := []struct {
+		name     string
+		id       string
+		err      error
+		wantCode int
+	}{
+		{name: "cancelled", id: "7", wantCode: http.StatusOK},
+		{name: "invalid id", id: "seven", wantCode: http.StatusBadRequest},
+		{name: "not found", id: "7", err: sql.ErrNoRows, wantCode: http.StatusNotFound},
+		{
+			name:     "no longer waiting",
+			id:       "7",
+			err:      fmt.Errorf("%w: transaction is in the %s state", errInvalidState, IN_FLIGHT),
+			wantCode: http.StatusConflict,
+		},
+		{name: "database error", id: "7", err: sql.ErrConnDone, wantCode: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewCancelHandler(noop.NewTracerProvider().Tracer(""), cancelRepository{err: tt.err})
+			r := httptest.NewRequest("POST", "/transactions/"+tt.id+"/cancel", nil)
+			r.SetPathValue("id", tt.id)
+			w := httptest.NewRecorder()
+
+			h.ServeHTTP(w, r)
+			if w.Code != tt.wantCode {
+				t.Errorf("ServeHTTP() status = %d, want %d", w.Code, tt.wantCode)
+			}
+		})
+	}
+}
+
+// listRepository lists count transactions after afterID, and leaves every other method of the Repository
+// unimplemented.
+type listRepository struct {
+	Repository
+	count   int
+	afterID int
+}
+
+func (r *listRepository) fetchTransactions(_ context.Context, _ transactionFilter, afterID int, limit int) ([]transactionStatus, error) {
+	r.afterID = afterID
+	transactions := make([]transactionStatus, 0, min(r.count, limit))
+	for i := range min(r.count, limit) {
+		transactions = append(transactions, transactionStatus{ID: afterID + i + 1, State: RETRY})
+	}
+	return transactions, nil
+}
+
+func TestListTransactionsHandlerPages(t *testing.T) {
+	tests := []struct {
+		name            string
+		target          string
+		count           int
+		wantCode        int
+		wantAfterID     int
+		wantNextAfterID int
+	}{
+		{
+			name:            "full page",
+			target:          "/transactions?state=retry&after_id=10&limit=2",
+			count:           5,
+			wantCode:        http.StatusOK,
+			wantAfterID:     10,
+			wantNextAfterID: 12,
+		},
+		{
+			name:        "last page",
+			target:      "/transactions?after_id=10&limit=2",
+			count:       1,
+			wantCode:    http.StatusOK,
+			wantAfterID: 10,
+		},
+		{
+			name:     "unknown state",
+			target:   "/transactions?state=retrying",
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "invalid cursor",
+			target:   "/transactions?after_id=last",
+			wantCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repository := &listRepository{count: tt.count}
+			h := NewListHandler(noop.NewTracerProvider().Tracer(""), repository)
+			w := httptest.NewRecorder()
+
+			h.ServeHTTP(w, httptest.NewRequest("GET", tt.target, nil))
+			if w.Code != tt.wantCode {
+				t.Fatalf("ServeHTTP() status = %d, want %d", w.Code, tt.wantCode)
+			}
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+
+			var resp commons.ListTransactionsResponse
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatalf("failed to decode the response: %v", err)
+			}
+			if repository.afterID != tt.wantAfterID {
+				t.Errorf("ServeHTTP() fetched after %d, want after %d", repository.afterID, tt.wantAfterID)
+			}
+			if resp.NextAfterID != tt.wantNextAfterID {
+				t.Errorf("ServeHTTP() next after id = %d, want %d", resp.NextAfterID, tt.wantNextAfterID)
+			}
+		})
+	}
+}
+
+// replayRepository replays the transactions with IDs following afterID, and leaves every other method of the
+// Repository unimplemented.
+type replayRepository struct {
+	Repository
+	matched int
+	mode    string
+	limit   int
+}
+
+func (r *replayRepository) countReplayableTransactions(context.Context, transactionFilter, int) (int, error) {
+	return r.matched, nil
+}
+
+func (r *replayRepository) replayTransactions(_ context.Context, _ transactionFilter, mode string, afterID int, limit int) ([]int, int, error) {
+	r.mode = mode
+	r.limit = limit
+	ids := make([]int, 0, min(r.matched, limit))
+	for i := range min(r.matched, limit) {
+		ids = append(ids, afterID+i+1)
+	}
+	return ids, afterID + len(ids), nil
+}
+
+func TestReplayTransactionsHandler(t *testing.T) {
+	tests := []struct {
+		name            string
+		body            string
+		matched         int
+		wantCode        int
+		wantMode        string
+		wantLimit       int
+		wantMatched     int
+		wantIDs         int
+		wantNextAfterID int
+	}{
+		{
+			name:        "defaults",
+			body:        `{"ids": [1, 2, 3]}`,
+			matched:     3,
+			wantCode:    http.StatusOK,
+			wantMode:    commons.ReplayModeReset,
+			wantLimit:   defaultListLimit,
+			wantMatched: 3,
+			wantIDs:     3,
+		},
+		{
+			name:            "full chunk of clones",
+			body:            `{"filter": {"states": ["FAILED"]}, "mode": "clone", "after_id": 10, "limit": 2}`,
+			matched:         5,
+			wantCode:        http.StatusOK,
+			wantMode:        commons.ReplayModeClone,
+			wantLimit:       2,
+			wantMatched:     2,
+			wantIDs:         2,
+			wantNextAfterID: 12,
+		},
+		{
+			name:        "dry run",
+			body:        `{"filter": {"states": ["FAILED"]}, "dry_run": true, "limit": 2}`,
+			matched:     5,
+			wantCode:    http.StatusOK,
+			wantMatched: 5,
+		},
+		{
+			name:     "unknown state",
+			body:     `{"filter": {"states": ["FAILING"]}}`,
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "unknown mode",
+			body:     `{"ids": [1], "mode": "move"}`,
+			wantCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repository := &replayRepository{matched: tt.matched}
+			h := NewReplayHandler(noop.NewTracerProvider().Tracer(""), repository)
+			w := httptest.NewRecorder()
+
+			h.ServeHTTP(w, httptest.NewRequest("POST", "/admin/transactions/replay", strings.NewReader(tt.body)))
+			if w.Code != tt.wantCode {
+				t.Fatalf("ServeHTTP() status = %d, want %d", w.Code, tt.wantCode)
+			}
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+
+			var resp commons.ReplayTransactionsResponse
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatalf("failed to decode the response: %v", err)
+			}
+			if repository.mode != tt.wantMode || repository.limit != tt.wantLimit {
+				t.Errorf("ServeHTTP() replayed with mode %q and limit %d, want %q and %d",
+					repository.mode, repository.limit, tt.wantMode, tt.wantLimit)
+			}
+			if resp.Matched != tt.wantMatched || len(resp.TransactionIDs) != tt.wantIDs || resp.NextAfterID != tt.wantNextAfterID {
+				t.Errorf("ServeHTTP() = %+v, want %d matched, %d ids and next after id %d",
+					resp, tt.wantMatched, tt.wantIDs, tt.wantNextAfterID)
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package transaction
+
+import (
+	"context"
+	"github.com/jackc/pgx/v5"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// readyChannel is notified by the transactions_notify_ready trigger whenever a transaction becomes due.
+const readyChannel = "transactions_ready"
+
+// Listener listens for the transactions which become due, and wakes the workers up, so they do not have to wait for
+// the next tick.
+type Listener struct {
+	url            string
+	reconnectDelay time.Duration
+	mu             sync.Mutex
+	subscribers    []chan struct{}
+}
+
+func NewListener(url string, reconnectDelay time.Duration) *Listener {
+	return &Listener{
+		url:            url,
+		reconnectDelay: reconnectDelay,
+	}
+}
+
+// subscribe returns a channel which receives a value after the transactions become due. The notifications which arrive
+// before the previous one has been received are coalesced.
+func (l *Listener) subscribe() <-chan struct{} {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	ch := make(chan struct{}, 1)
+	l.subscribers = append(l.subscribers, ch)
+	return ch
+}
+
+func (l *Listener) wake() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, ch := range l.subscribers {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// start keeps a dedicated connection listening until the context is done, and reconnects whenever it is lost. In the
+// meantime, the workers rely on their tickers.
+func (l *Listener) start(ctx context.Context) {
+	for {
+		err := l.listen(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		slog.Error("encountered error while listening for the due transactions", "error", err)
+
+		if err = sleep(ctx, l.reconnectDelay); err != nil {
+			return
+		}
+	}
+}
+
+func (l *Listener) listen(ctx context.Context) error {
+	conn, err := pgx.Connect(ctx, l.url)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := conn.Close(context.WithoutCancel(ctx)); err != nil {
+			slog.Error("encountered error while trying to close the listener connection", "error", err)
+		}
+	}()
+
+	if _, err = conn.Exec(ctx, "LISTEN "+readyChannel); err != nil {
+		return err
+	}
+	// The notifications sent while the connection was down are lost.
+	l.wake()
+
+	for {
+		if _, err = conn.WaitForNotification(ctx); err != nil {
+			return err
+		}
+		l.wake()
+	}
+}
@@ -0,0 +1,90 @@
+package transaction
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mat-sik/sql-distributed-transactions/server/internal/config"
+)
+
+func TestListenerWakeCoalescesNotifications(t *testing.T) {
+	l := NewListener("", time.Second)
+	first, second := l.subscribe(), l.subscribe()
+
+	l.wake()
+	l.wake()
+	l.wake()
+
+	for i, ch := range []<-chan struct{}{first, second} {
+		select {
+		case <-ch:
+		default:
+			t.Fatalf("subscriber %d was not woken up", i)
+		}
+		select {
+		case <-ch:
+			t.Errorf("subscriber %d was woken up more than once", i)
+		default:
+		}
+	}
+
+	l.wake()
+	select {
+	case <-first:
+	default:
+		t.Error("subscriber was not woken up again after receiving the previous wakeup")
+	}
+}
+
+// claimingRepository hands out the given batches in order, with the leases already expired, so the transactions are
+// released without being called.
+type claimingRepository struct {
+	recordingRepository
+	batches [][]transaction
+	err     error
+	claims  int
+}
+
+func (r *claimingRepository) claimTransactions(context.Context, string, time.Duration, time.Duration, int) ([]transaction, error) {
+	r.claims++
+	if len(r.batches) == 0 {
+		return nil, r.err
+	}
+	batch := r.batches[0]
+	r.batches = r.batches[1:]
+	return batch, nil
+}
+
+func TestExecTransactionBatchesDrainsFullBatches(t *testing.T) {
+	batch := func(size int) []transaction {
+		return make([]transaction, size)
+	}
+
+	tests := []struct {
+		name       string
+		batches    [][]transaction
+		err        error
+		wantClaims int
+	}{
+		{name: "nothing due", wantClaims: 1},
+		{name: "partial batch", batches: [][]transaction{batch(1)}, wantClaims: 1},
+		{name: "full batches", batches: [][]transaction{batch(2), batch(2), batch(1)}, wantClaims: 3},
+		{name: "full batches until empty", batches: [][]transaction{batch(2), batch(2)}, wantClaims: 3},
+		{name: "claim failure", batches: [][]transaction{batch(2)}, err: errors.New("connection reset"), wantClaims: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repository := &claimingRepository{batches: tt.batches, err: tt.err}
+			e := newTestWorkerExecutor(t, repository)
+			e.config = config.Executor{BatchSize: 2, SenderAmount: 1}
+
+			e.execTransactionBatches(context.Background())
+			if repository.claims != tt.wantClaims {
+				t.Errorf("execTransactionBatches() claimed %d times, want %d", repository.claims, tt.wantClaims)
+			}
+		})
+	}
+}
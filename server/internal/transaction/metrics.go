@@ -0,0 +1,437 @@
+package transaction
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/mat-sik/sql-distributed-transactions/server/internal/logging"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+type executorMetrics struct {
+	claimed         metric.Int64Counter
+	queueDelay      metric.Float64Histogram
+	batchFillRatio  metric.Float64Histogram
+	finished        metric.Int64Counter
+	delivered       metric.Int64Counter
+	retried         metric.Int64Counter
+	failed          metric.Int64Counter
+	deliveryLatency metric.Float64Histogram
+	attemptDuration metric.Float64Histogram
+	inFlight        metric.Int64UpDownCounter
+	shortCircuited  metric.Int64Counter
+	rateLimited     metric.Int64Counter
+}
+
+func newExecutorMetrics(
+	meter metric.Meter,
+	repository Repository,
+	breakers *CircuitBreakers,
+	queueStatsInterval time.Duration,
+) (executorMetrics, error) {
+	claimed, err := meter.Int64Counter(
+		"transactions.claimed",
+		metric.WithDescription("Number of transactions claimed by the workers"),
+		metric.WithUnit("{transaction}"),
+	)
+	if err != nil {
+		return executorMetrics{}, err
+	}
+
+	queueDelay, err := meter.Float64Histogram(
+		"transactions.queue_delay",
+		metric.WithDescription("Time between a transaction becoming due and being claimed"),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		return executorMetrics{}, err
+	}
+
+	batchFillRatio, err := meter.Float64Histogram(
+		"transactions.batch_fill_ratio",
+		metric.WithDescription("Number of transactions claimed at once, relative to the batch size"),
+		metric.WithUnit("1"),
+		metric.WithExplicitBucketBoundaries(0, 0.1, 0.25, 0.5, 0.75, 0.9, 1),
+	)
+	if err != nil {
+		return executorMetrics{}, err
+	}
+
+	finished, err := meter.Int64Counter(
+		"transactions.finished",
+		metric.WithDescription("Number of transactions which have reached a terminal state"),
+		metric.WithUnit("{transaction}"),
+	)
+	if err != nil {
+		return executorMetrics{}, err
+	}
+
+	delivered, err := meter.Int64Counter(
+		"transactions.delivered",
+		metric.WithDescription("Number of attempts which have delivered their transaction"),
+		metric.WithUnit("{attempt}"),
+	)
+	if err != nil {
+		return executorMetrics{}, err
+	}
+
+	retried, err := meter.Int64Counter(
+		"transactions.retried",
+		metric.WithDescription("Number of attempts after which their transaction is going to be retried"),
+		metric.WithUnit("{attempt}"),
+	)
+	if err != nil {
+		return executorMetrics{}, err
+	}
+
+	failed, err := meter.Int64Counter(
+		"transactions.failed",
+		metric.WithDescription("Number of attempts after which their transaction has failed for good"),
+		metric.WithUnit("{attempt}"),
+	)
+	if err != nil {
+		return executorMetrics{}, err
+	}
+
+	deliveryLatency, err := meter.Float64Histogram(
+		"transactions.delivery_latency",
+		metric.WithDescription("Time between a transaction being enqueued and being delivered"),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		return executorMetrics{}, err
+	}
+
+	attemptDuration, err := meter.Float64Histogram(
+		"transactions.attempt_duration",
+		metric.WithDescription("Duration of the calls made to the remote hosts"),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		return executorMetrics{}, err
+	}
+
+	inFlight, err := meter.Int64UpDownCounter(
+		"transactions.in_flight",
+		metric.WithDescription("Number of calls to the remote hosts the senders are waiting for"),
+		metric.WithUnit("{call}"),
+	)
+	if err != nil {
+		return executorMetrics{}, err
+	}
+
+	shortCircuited, err := meter.Int64Counter(
+		"transactions.short_circuited",
+		metric.WithDescription("Number of transactions rescheduled without a call, because the circuit of their host is open"),
+		metric.WithUnit("{transaction}"),
+	)
+	if err != nil {
+		return executorMetrics{}, err
+	}
+
+	rateLimited, err := meter.Int64Counter(
+		"transactions.rate_limited",
+		metric.WithDescription("Number of transactions rescheduled without a call, because their host is at its limits"),
+		metric.WithUnit("{transaction}"),
+	)
+	if err != nil {
+		return executorMetrics{}, err
+	}
+
+	_, err = meter.Int64ObservableGauge(
+		"circuit_breaker.state",
+		metric.WithDescription("State of the circuit of a remote host, 0 when closed, 1 when half-open and 2 when open"),
+		metric.WithInt64Callback(func(_ context.Context, observer metric.Int64Observer) error {
+			for _, breaker := range breakers.snapshot() {
+				observer.Observe(circuitStateValues[circuitState(breaker.State)], metric.WithAttributes(
+					attribute.String("host", breaker.Host),
+				))
+			}
+			return nil
+		}),
+	)
+	if err != nil {
+		return executorMetrics{}, err
+	}
+
+	if err = registerQueueMetrics(meter, repository, queueStatsInterval); err != nil {
+		return executorMetrics{}, err
+	}
+
+	return executorMetrics{
+		claimed:         claimed,
+		queueDelay:      queueDelay,
+		batchFillRatio:  batchFillRatio,
+		finished:        finished,
+		delivered:       delivered,
+		retried:         retried,
+		failed:          failed,
+		deliveryLatency: deliveryLatency,
+		attemptDuration: attemptDuration,
+		inFlight:        inFlight,
+		shortCircuited:  shortCircuited,
+		rateLimited:     rateLimited,
+	}, nil
+}
+
+func (m executorMetrics) recordClaimed(ctx context.Context, transactions []transaction, batchSize int, claimedAt time.Time) {
+	m.batchFillRatio.Record(ctx, float64(len(transactions))/float64(batchSize))
+	for _, t := range transactions {
+		band := metric.WithAttributes(priorityBandAttribute(t.Priority))
+		m.claimed.Add(ctx, 1, band)
+		m.queueDelay.Record(ctx, max(claimedAt.Sub(t.NextAttemptAt), 0).Seconds(), band)
+	}
+}
+
+// recordAttempted accounts for a call whose outcome has been written back, in the state the transaction has been
+// moved to.
+func (m executorMetrics) recordAttempted(ctx context.Context, tResp transactionResponse, s state, finishedAt time.Time) {
+	attributes := metric.WithAttributes(
+		attribute.String("host", tResp.Host),
+		attribute.String("status_class", tResp.StatusClass),
+	)
+	switch s {
+	case DONE:
+		m.delivered.Add(ctx, 1, attributes)
+		m.deliveryLatency.Record(ctx, finishedAt.Sub(tResp.CreatedAt).Seconds(), metric.WithAttributes(
+			attribute.String("host", tResp.Host),
+		))
+	case RETRY:
+		m.retried.Add(ctx, 1, attributes)
+	case FAILED:
+		m.failed.Add(ctx, 1, attributes)
+	}
+}
+
+func (m executorMetrics) recordFinished(ctx context.Context, priority int, s state) {
+	m.finished.Add(ctx, 1, metric.WithAttributes(
+		priorityBandAttribute(priority),
+		attribute.String("state", string(s)),
+	))
+}
+
+// recordCall tracks a call to the host until the returned function is called with its outcome.
+func (m executorMetrics) recordCall(ctx context.Context, host string, startedAt time.Time) func(result callResult, finishedAt time.Time) {
+	m.inFlight.Add(ctx, 1, metric.WithAttributes(attribute.String("host", host)))
+	return func(result callResult, finishedAt time.Time) {
+		m.inFlight.Add(ctx, -1, metric.WithAttributes(attribute.String("host", host)))
+		m.attemptDuration.Record(ctx, finishedAt.Sub(startedAt).Seconds(), metric.WithAttributes(
+			attribute.String("host", host),
+			attribute.String("status_class", statusClass(result)),
+		))
+	}
+}
+
+func (m executorMetrics) recordShortCircuited(ctx context.Context, host string) {
+	m.shortCircuited.Add(ctx, 1, metric.WithAttributes(attribute.String("host", host)))
+}
+
+func (m executorMetrics) recordRateLimited(ctx context.Context, host string) {
+	m.rateLimited.Add(ctx, 1, metric.WithAttributes(attribute.String("host", host)))
+}
+
+// enqueuedTransactions counts the transactions inserted into the queue, whether through the API, a saga, a two-phase
+// commit, a recurring transaction or a replay. The transactions inserted within a sql transaction are held until it
+// finishes, so the ones which are rolled back are not counted. The outbox inserts within the sql transactions of its
+// callers, which commit them out of sight, so its transactions are not counted.
+type enqueuedTransactions struct {
+	counter metric.Int64Counter
+	mu      sync.Mutex
+	pending map[*sql.Tx][]string
+}
+
+func newEnqueuedTransactions(meter metric.Meter) (*enqueuedTransactions, error) {
+	counter, err := meter.Int64Counter(
+		"transactions.enqueued",
+		metric.WithDescription("Number of transactions enqueued, without the duplicates"),
+		metric.WithUnit("{transaction}"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &enqueuedTransactions{
+		counter: counter,
+		pending: make(map[*sql.Tx][]string),
+	}, nil
+}
+
+// record counts the transactions which have already been committed.
+func (e *enqueuedTransactions) record(ctx context.Context, hosts ...string) {
+	for _, host := range hosts {
+		e.counter.Add(ctx, 1, metric.WithAttributes(attribute.String("host", host)))
+	}
+}
+
+// hold keeps the transaction inserted within tx until tx finishes.
+func (e *enqueuedTransactions) hold(tx *sql.Tx, host string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.pending[tx] = append(e.pending[tx], host)
+}
+
+// held returns how many transactions are held for tx, so a savepoint can drop the ones inserted after it.
+func (e *enqueuedTransactions) held(tx *sql.Tx) int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return len(e.pending[tx])
+}
+
+func (e *enqueuedTransactions) dropAfter(tx *sql.Tx, held int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if hosts, ok := e.pending[tx]; ok {
+		e.pending[tx] = hosts[:held]
+	}
+}
+
+// finish counts the transactions held for tx when it has committed, and drops them otherwise.
+func (e *enqueuedTransactions) finish(tx *sql.Tx, committed bool) {
+	e.mu.Lock()
+	hosts := e.pending[tx]
+	delete(e.pending, tx)
+	e.mu.Unlock()
+
+	if committed {
+		e.record(context.Background(), hosts...)
+	}
+}
+
+// registerQueueMetrics observes the depth of the queue by state. The whole queue is counted, so every replica reports
+// the same values, and the counts are refreshed at most once per interval to keep the load off the database.
+func registerQueueMetrics(meter metric.Meter, repository Repository, interval time.Duration) error {
+	depth, err := meter.Int64ObservableGauge(
+		"transactions.queue_depth",
+		metric.WithDescription("Number of transactions waiting for or undergoing an attempt"),
+		metric.WithUnit("{transaction}"),
+	)
+	if err != nil {
+		return err
+	}
+
+	oldestAge, err := meter.Float64ObservableGauge(
+		"transactions.oldest_age",
+		metric.WithDescription("Time the longest waiting transaction has been due for"),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		return err
+	}
+
+	cache := &queueStatsCache{
+		repository: repository,
+		interval:   interval,
+	}
+	_, err = meter.RegisterCallback(func(ctx context.Context, observer metric.Observer) error {
+		for _, stats := range cache.get(ctx) {
+			s := metric.WithAttributes(attribute.String("state", string(stats.State)))
+			observer.ObserveInt64(depth, int64(stats.Count), s)
+			observer.ObserveFloat64(oldestAge, stats.OldestAge.Seconds(), s)
+		}
+		return nil
+	}, depth, oldestAge)
+	return err
+}
+
+type queueStats struct {
+	State     state
+	Count     int
+	OldestAge time.Duration
+}
+
+type queueStatsCache struct {
+	repository Repository
+	interval   time.Duration
+	mu         sync.Mutex
+	stats      []queueStats
+	fetchedAt  time.Time
+}
+
+// get returns the last fetched stats while they are fresh. A failed fetch is only logged, and the stale stats are
+// returned instead.
+func (c *queueStatsCache) get(ctx context.Context) []queueStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if time.Since(c.fetchedAt) < c.interval {
+		return c.stats
+	}
+	stats, err := c.repository.fetchQueueStats(ctx)
+	if err != nil {
+		slog.Error("encountered error while trying to fetch the queue stats", "error", err)
+		return c.stats
+	}
+	c.stats = stats
+	c.fetchedAt = time.Now()
+	return stats
+}
+
+// fetchQueueStats counts the transactions in each of the non-terminal states, and finds how long the longest waiting
+// one has been due for.
+func (r SQLRepository) fetchQueueStats(ctx context.Context) ([]queueStats, error) {
+	query := `
+		SELECT s.state,
+		       count(t.id),
+		       coalesce(extract(epoch FROM greatest(now() - min(t.next_attempt_at), interval '0')), 0)::float8
+		FROM (VALUES ('PENDING'), ('RETRY'), ('IN_FLIGHT')) AS s (state)
+		LEFT JOIN transactions t ON t.state = s.state
+		GROUP BY s.state
+		ORDER BY s.state
+	`
+
+	stmt, err := r.pool.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer logging.LoggedClose(stmt)
+
+	rows, err := stmt.QueryContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer logging.LoggedClose(rows)
+
+	var stats []queueStats
+	for rows.Next() {
+		var s queueStats
+		var oldestAge float64
+		if err = rows.Scan(&s.State, &s.Count, &oldestAge); err != nil {
+			return nil, err
+		}
+		s.OldestAge = time.Duration(oldestAge * float64(time.Second))
+		stats = append(stats, s)
+	}
+	return stats, rows.Err()
+}
+
+var circuitStateValues = map[circuitState]int64{
+	circuitClosed:   0,
+	circuitHalfOpen: 1,
+	circuitOpen:     2,
+}
+
+// priorityBandAttribute groups the priorities into a few bands, to keep the cardinality of the metrics low.
+func priorityBandAttribute(priority int) attribute.KeyValue {
+	band := "normal"
+	if priority > 0 {
+		band = "high"
+	} else if priority < 0 {
+		band = "low"
+	}
+	return attribute.String("priority_band", band)
+}
+
+// statusClass groups the outcomes of the calls the same way as the status selectors, e.g. 5xx or timeout.
+func statusClass(result callResult) string {
+	if result.Failure != "" {
+		return string(result.Failure)
+	}
+	return fmt.Sprintf("%dxx", result.StatusCode/100)
+}
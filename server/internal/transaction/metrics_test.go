@@ -0,0 +1,55 @@
+package transaction
+
+import (
+	"context"
+	"database/sql"
+	"slices"
+	"testing"
+
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/embedded"
+)
+
+// hostCounter records the host of every increment.
+type hostCounter struct {
+	embedded.Int64Counter
+	hosts []string
+}
+
+func (c *hostCounter) Add(_ context.Context, incr int64, options ...metric.AddOption) {
+	attributes := metric.NewAddConfig(options).Attributes()
+	host, _ := attributes.Value("host")
+	for range incr {
+		c.hosts = append(c.hosts, host.AsString())
+	}
+}
+
+func (c *hostCounter) Enabled(context.Context) bool {
+	return true
+}
+
+func TestEnqueuedTransactionsCountsCommittedOnly(t *testing.T) {
+	counter := &hostCounter{}
+	enqueued := &enqueuedTransactions{counter: counter, pending: make(map[*sql.Tx][]string)}
+	committed, rolledBack := &sql.Tx{}, &sql.Tx{}
+
+	enqueued.hold(committed, "a.example.com")
+	enqueued.hold(rolledBack, "b.example.com")
+	held := enqueued.held(committed)
+	enqueued.hold(committed, "c.example.com")
+	enqueued.dropAfter(committed, held)
+	enqueued.hold(committed, "d.example.com")
+
+	if len(counter.hosts) != 0 {
+		t.Fatalf("counted %v before the sql transactions finished", counter.hosts)
+	}
+
+	enqueued.finish(rolledBack, false)
+	enqueued.finish(committed, true)
+	if want := []string{"a.example.com", "d.example.com"}; !slices.Equal(counter.hosts, want) {
+		t.Errorf("counted %v, want %v", counter.hosts, want)
+	}
+	if len(enqueued.pending) != 0 {
+		t.Errorf("still holding %v after the sql transactions finished", enqueued.pending)
+	}
+}
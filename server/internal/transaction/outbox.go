@@ -0,0 +1,29 @@
+package transaction
+
+import (
+	"context"
+	"database/sql"
+	"github.com/mat-sik/sql-distributed-transactions/server/internal/tracing"
+
+	commons "github.com/mat-sik/sql-distributed-transactions/common/transaction"
+)
+
+// EnqueueInTx enqueues the transaction within the given sql transaction, so it is only sent once the caller commits.
+// Like the enqueue endpoint, it returns the ID of the existing transaction when the idempotency key is already taken.
+func EnqueueInTx(ctx context.Context, tx *sql.Tx, req commons.EnqueueTransactionRequest) (id int, created bool, err error) {
+	if err = commons.ValidRequest(req); err != nil {
+		return 0, false, err
+	}
+
+	carrierJSON, err := tracing.MarshalContext(ctx)
+	if err != nil {
+		return 0, false, err
+	}
+
+	createT, err := newCreateTransaction(req, carrierJSON)
+	if err != nil {
+		return 0, false, err
+	}
+
+	return enqueueTransaction(ctx, tx, createT)
+}
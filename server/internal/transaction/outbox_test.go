@@ -0,0 +1,37 @@
+package transaction
+
+import (
+	"context"
+	"testing"
+
+	commons "github.com/mat-sik/sql-distributed-transactions/common/transaction"
+)
+
+func TestEnqueueInTxRejectsInvalidRequest(t *testing.T) {
+	tests := []struct {
+		name string
+		req  commons.EnqueueTransactionRequest
+	}{
+		{
+			name: "missing host",
+			req:  commons.EnqueueTransactionRequest{Path: "/transactions", Method: "POST"},
+		},
+		{
+			name: "invalid method",
+			req:  commons.EnqueueTransactionRequest{Host: "dummy:40691", Path: "/transactions", Method: "FETCH"},
+		},
+		{
+			name: "negative max attempts",
+			req:  commons.EnqueueTransactionRequest{Host: "dummy:40691", Path: "/transactions", Method: "POST", MaxAttempts: -1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The sql transaction is nil, so the test panics if anything is written within it.
+			if _, _, err := EnqueueInTx(context.Background(), nil, tt.req); err == nil {
+				t.Error("EnqueueInTx() error = nil, want the request rejected")
+			}
+		})
+	}
+}
@@ -0,0 +1,207 @@
+package transaction
+
+import (
+	"context"
+	"fmt"
+	"github.com/mat-sik/sql-distributed-transactions/server/internal/config"
+	"github.com/mat-sik/sql-distributed-transactions/server/internal/logging"
+	"golang.org/x/time/rate"
+	"log/slog"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// HostLimiters enforces the rate limits and the in-flight caps of the remote hosts, across all the workers of the
+// process. The hosts of a profile share its limits.
+type HostLimiters struct {
+	mu           sync.Mutex
+	limiters     map[string]*hostLimiter
+	hostProfiles map[string]string
+	config       config.RateLimits
+	repository   Repository
+}
+
+type hostLimiter struct {
+	// key names the limiter, and its bucket when the limits are coordinated through Postgres.
+	key      string
+	limit    config.RateLimit
+	rate     *rate.Limiter
+	inFlight chan struct{}
+}
+
+func NewHostLimiters(rateLimits config.RateLimits, repository Repository) (*HostLimiters, error) {
+	hostProfiles := make(map[string]string)
+	for name, profile := range rateLimits.Profiles {
+		for _, host := range profile.Hosts {
+			if _, ok := hostProfiles[host]; ok {
+				return nil, fmt.Errorf("host %s belongs to more than one rate limit profile", host)
+			}
+			hostProfiles[host] = name
+		}
+	}
+
+	return &HostLimiters{
+		limiters:     make(map[string]*hostLimiter),
+		hostProfiles: hostProfiles,
+		config:       rateLimits,
+		repository:   repository,
+	}, nil
+}
+
+// acquire waits up to the configured maximum for the host to accept another call. When the call can be made, it
+// returns the function which frees the in-flight slot once the call is done. Otherwise, it returns how long to wait
+// before trying again.
+func (h *HostLimiters) acquire(ctx context.Context, host string) (func(), time.Duration, error) {
+	l := h.limiter(host)
+
+	release := func() {}
+	if l.inFlight != nil {
+		timer := time.NewTimer(h.config.MaxWait)
+		defer timer.Stop()
+
+		select {
+		case <-ctx.Done():
+			return nil, 0, ctx.Err()
+		case <-timer.C:
+			return nil, h.config.MaxWait, nil
+		case l.inFlight <- struct{}{}:
+			release = func() { <-l.inFlight }
+		}
+	}
+
+	if l.limit.RequestsPerSecond <= 0 {
+		return release, 0, nil
+	}
+
+	delay, cancel, err := h.reserve(ctx, l)
+	if err != nil {
+		release()
+		return nil, 0, err
+	}
+	if delay > h.config.MaxWait {
+		cancel()
+		release()
+		return nil, delay, nil
+	}
+	if err = sleep(ctx, delay); err != nil {
+		cancel()
+		release()
+		return nil, 0, err
+	}
+	return release, 0, nil
+}
+
+// reserve takes a token from the bucket of the limiter, possibly ahead of time. It returns how long to wait until the
+// token becomes valid, and the function which gives it back.
+func (h *HostLimiters) reserve(ctx context.Context, l *hostLimiter) (time.Duration, func(), error) {
+	if !h.config.Coordinated {
+		reservation := l.rate.Reserve()
+		return reservation.Delay(), reservation.Cancel, nil
+	}
+
+	tokens, err := h.repository.takeRateLimitToken(ctx, l.key, l.limit.RequestsPerSecond, l.limit.BurstOrDefault())
+	if err != nil {
+		return 0, nil, err
+	}
+	cancel := func() {
+		// The cancellation can only make the limit stricter, so a failure to give the token back is only logged.
+		if err := h.repository.returnRateLimitToken(context.WithoutCancel(ctx), l.key); err != nil {
+			slog.Error("encountered error while trying to return a rate limit token", "error", err)
+		}
+	}
+	if tokens >= 0 {
+		return 0, cancel, nil
+	}
+	return time.Duration(-tokens / l.limit.RequestsPerSecond * float64(time.Second)), cancel, nil
+}
+
+func (h *HostLimiters) limiter(host string) *hostLimiter {
+	key, limit := host, h.config.Default
+	if name, ok := h.profileName(host); ok {
+		key, limit = "profile:"+name, h.config.Profiles[name]
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	l, ok := h.limiters[key]
+	if !ok {
+		l = &hostLimiter{
+			key:   key,
+			limit: limit,
+		}
+		if limit.RequestsPerSecond > 0 {
+			l.rate = rate.NewLimiter(rate.Limit(limit.RequestsPerSecond), limit.BurstOrDefault())
+		}
+		if limit.MaxInFlight > 0 {
+			l.inFlight = make(chan struct{}, limit.MaxInFlight)
+		}
+		h.limiters[key] = l
+	}
+	return l
+}
+
+// profileName looks the host up with the port, then without it.
+func (h *HostLimiters) profileName(host string) (string, bool) {
+	if name, ok := h.hostProfiles[host]; ok {
+		return name, true
+	}
+	hostname := (&url.URL{Host: host}).Hostname()
+	name, ok := h.hostProfiles[hostname]
+	return name, ok
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// takeRateLimitToken refills the bucket by the time passed since its last refill, and takes a token from it. The
+// bucket goes below zero when the token is taken ahead of time, so it returns the tokens left, which are negative in
+// that case.
+func (r SQLRepository) takeRateLimitToken(ctx context.Context, key string, requestsPerSecond float64, burst int) (float64, error) {
+	query := `
+		INSERT INTO rate_limit_buckets AS b (key, tokens, refilled_at)
+		VALUES ($1, $3::float8 - 1, now())
+		ON CONFLICT (key) DO UPDATE
+		SET tokens = least($3::float8, b.tokens + extract(epoch FROM now() - b.refilled_at) * $2::float8) - 1,
+		    refilled_at = now()
+		RETURNING tokens
+	`
+
+	stmt, err := r.pool.PrepareContext(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+	defer logging.LoggedClose(stmt)
+
+	var tokens float64
+	err = stmt.QueryRowContext(ctx, key, requestsPerSecond, float64(burst)).Scan(&tokens)
+	return tokens, err
+}
+
+func (r SQLRepository) returnRateLimitToken(ctx context.Context, key string) error {
+	query := `
+		UPDATE rate_limit_buckets SET tokens = tokens + 1 WHERE key = $1
+	`
+
+	stmt, err := r.pool.PrepareContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer logging.LoggedClose(stmt)
+
+	_, err = stmt.ExecContext(ctx, key)
+	return err
+}
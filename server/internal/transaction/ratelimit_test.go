@@ -0,0 +1,166 @@
+package transaction
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mat-sik/sql-distributed-transactions/server/internal/config"
+)
+
+func TestNewHostLimitersRejectsHostInTwoProfiles(t *testing.T) {
+	rateLimits := config.RateLimits{Profiles: map[string]config.RateLimit{
+		"partner": {Hosts: []string{"a.example.com"}},
+		"vendor":  {Hosts: []string{"a.example.com"}},
+	}}
+	if _, err := NewHostLimiters(rateLimits, nil); err == nil {
+		t.Error("NewHostLimiters() error = nil, want the shared host rejected")
+	}
+}
+
+func TestHostLimitersProfileName(t *testing.T) {
+	limiters, err := NewHostLimiters(config.RateLimits{Profiles: map[string]config.RateLimit{
+		"partner": {Hosts: []string{"a.example.com"}},
+		"vendor":  {Hosts: []string{"b.example.com:8443"}},
+	}}, nil)
+	if err != nil {
+		t.Fatalf("NewHostLimiters() error = %v", err)
+	}
+
+	tests := []struct {
+		host     string
+		wantName string
+		wantOk   bool
+	}{
+		{host: "a.example.com", wantName: "partner", wantOk: true},
+		{host: "a.example.com:8080", wantName: "partner", wantOk: true},
+		{host: "b.example.com:8443", wantName: "vendor", wantOk: true},
+		{host: "b.example.com", wantOk: false},
+		{host: "c.example.com", wantOk: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			name, ok := limiters.profileName(tt.host)
+			if name != tt.wantName || ok != tt.wantOk {
+				t.Errorf("profileName() = %q, %v, want %q, %v", name, ok, tt.wantName, tt.wantOk)
+			}
+		})
+	}
+}
+
+func TestHostLimitersAcquire(t *testing.T) {
+	const maxWait = 50 * time.Millisecond
+
+	tests := []struct {
+		name           string
+		limit          config.RateLimit
+		held           int
+		wantAcquired   bool
+		wantRetryAfter time.Duration
+	}{
+		{
+			name:         "no limits",
+			held:         10,
+			wantAcquired: true,
+		},
+		{
+			name:         "free in-flight slot",
+			limit:        config.RateLimit{MaxInFlight: 2},
+			held:         1,
+			wantAcquired: true,
+		},
+		{
+			name:           "in-flight cap reached",
+			limit:          config.RateLimit{MaxInFlight: 2},
+			held:           2,
+			wantRetryAfter: maxWait,
+		},
+		{
+			name:         "token available after a short wait",
+			limit:        config.RateLimit{RequestsPerSecond: 100, Burst: 1},
+			held:         1,
+			wantAcquired: true,
+		},
+		{
+			name:           "token too far ahead",
+			limit:          config.RateLimit{RequestsPerSecond: 1, Burst: 1},
+			held:           1,
+			wantRetryAfter: maxWait,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiters, err := NewHostLimiters(config.RateLimits{Default: tt.limit, MaxWait: maxWait}, nil)
+			if err != nil {
+				t.Fatalf("NewHostLimiters() error = %v", err)
+			}
+			ctx := context.Background()
+			for range tt.held {
+				if release, _, err := limiters.acquire(ctx, "a.example.com"); err != nil || release == nil {
+					t.Fatalf("acquire() acquired = %v, error = %v, want the slot acquired", release != nil, err)
+				}
+			}
+
+			release, retryAfter, err := limiters.acquire(ctx, "a.example.com")
+			if err != nil {
+				t.Fatalf("acquire() error = %v", err)
+			}
+			if (release != nil) != tt.wantAcquired {
+				t.Errorf("acquire() acquired = %v, want %v", release != nil, tt.wantAcquired)
+			}
+			if retryAfter < tt.wantRetryAfter {
+				t.Errorf("acquire() retry after = %v, want at least %v", retryAfter, tt.wantRetryAfter)
+			}
+		})
+	}
+}
+
+func TestHostLimitersShareProfileLimits(t *testing.T) {
+	limiters, err := NewHostLimiters(config.RateLimits{
+		MaxWait: time.Millisecond,
+		Profiles: map[string]config.RateLimit{
+			"partner": {Hosts: []string{"a.example.com", "b.example.com"}, MaxInFlight: 1},
+		},
+	}, nil)
+	if err != nil {
+		t.Fatalf("NewHostLimiters() error = %v", err)
+	}
+	ctx := context.Background()
+
+	release, _, err := limiters.acquire(ctx, "a.example.com")
+	if err != nil || release == nil {
+		t.Fatalf("acquire() acquired = %v, error = %v, want the slot acquired", release != nil, err)
+	}
+	if other, _, _ := limiters.acquire(ctx, "b.example.com"); other != nil {
+		t.Error("acquire() acquired a slot of the profile while it is held by another host")
+	}
+	if other, _, _ := limiters.acquire(ctx, "c.example.com"); other == nil {
+		t.Error("acquire() did not acquire a slot of a host outside the profile")
+	}
+
+	release()
+	if other, _, _ := limiters.acquire(ctx, "b.example.com"); other == nil {
+		t.Error("acquire() did not acquire the slot of the profile once it was released")
+	}
+}
+
+func TestHostLimitersAcquireHonoursCancellation(t *testing.T) {
+	limiters, err := NewHostLimiters(config.RateLimits{
+		Default: config.RateLimit{MaxInFlight: 1},
+		MaxWait: time.Minute,
+	}, nil)
+	if err != nil {
+		t.Fatalf("NewHostLimiters() error = %v", err)
+	}
+	if release, _, _ := limiters.acquire(context.Background(), "a.example.com"); release == nil {
+		t.Fatal("acquire() did not acquire the first slot")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, _, err := limiters.acquire(ctx, "a.example.com"); err == nil {
+		t.Error("acquire() error = nil, want the cancellation returned")
+	}
+}
@@ -0,0 +1,425 @@
+package transaction
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/mat-sik/sql-distributed-transactions/server/internal/config"
+	"github.com/mat-sik/sql-distributed-transactions/server/internal/logging"
+	"github.com/mat-sik/sql-distributed-transactions/server/internal/tracing"
+	"github.com/robfig/cron/v3"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"log/slog"
+	"strings"
+	"time"
+
+	commons "github.com/mat-sik/sql-distributed-transactions/common/transaction"
+)
+
+type recurringTransaction struct {
+	ID                int
+	Schedule          sql.NullString
+	IntervalSeconds   sql.NullFloat64
+	Request           string
+	NextFireAt        time.Time
+	LastFiredAt       sql.NullTime
+	LastTransactionID sql.NullInt64
+	CreatedAt         time.Time
+	UpdatedAt         time.Time
+}
+
+// upsertRecurringTransaction is the definition of a recurring transaction, as created or replaced through the API.
+type upsertRecurringTransaction struct {
+	Schedule        sql.NullString
+	IntervalSeconds sql.NullFloat64
+	Request         string
+	NextFireAt      time.Time
+}
+
+func newUpsertRecurringTransaction(req commons.RecurringTransactionRequest, now time.Time) (upsertRecurringTransaction, error) {
+	s, err := parseSchedule(req.Schedule, time.Duration(req.Interval))
+	if err != nil {
+		return upsertRecurringTransaction{}, err
+	}
+
+	request, err := json.Marshal(req.Transaction)
+	if err != nil {
+		return upsertRecurringTransaction{}, err
+	}
+
+	return upsertRecurringTransaction{
+		Schedule: sql.NullString{
+			String: req.Schedule,
+			Valid:  req.Schedule != "",
+		},
+		IntervalSeconds: sql.NullFloat64{
+			Float64: time.Duration(req.Interval).Seconds(),
+			Valid:   req.Interval != 0,
+		},
+		Request:    string(request),
+		NextFireAt: s.Next(now),
+	}, nil
+}
+
+// parseSchedule accepts standard five field cron expressions and descriptors such as @hourly. Schedules without a
+// CRON_TZ or TZ prefix are in UTC, rather than in the local time zone of the server.
+func parseSchedule(schedule string, interval time.Duration) (cron.Schedule, error) {
+	if schedule == "" {
+		return cron.Every(interval), nil
+	}
+	spec := schedule
+	if !strings.HasPrefix(spec, "CRON_TZ=") && !strings.HasPrefix(spec, "TZ=") {
+		spec = "CRON_TZ=UTC " + spec
+	}
+	s, err := cron.ParseStandard(spec)
+	if err != nil {
+		return nil, fmt.Errorf("schedule %s is invalid: %w", schedule, err)
+	}
+	return s, nil
+}
+
+func (t recurringTransaction) schedule() (cron.Schedule, error) {
+	interval := time.Duration(t.IntervalSeconds.Float64 * float64(time.Second))
+	return parseSchedule(t.Schedule.String, interval)
+}
+
+func (t recurringTransaction) toResponse() (commons.RecurringTransaction, error) {
+	resp := commons.RecurringTransaction{
+		ID:         t.ID,
+		Schedule:   t.Schedule.String,
+		Interval:   commons.Duration(t.IntervalSeconds.Float64 * float64(time.Second)),
+		NextFireAt: t.NextFireAt,
+		CreatedAt:  t.CreatedAt,
+		UpdatedAt:  t.UpdatedAt,
+	}
+	if err := json.Unmarshal([]byte(t.Request), &resp.Transaction); err != nil {
+		return commons.RecurringTransaction{}, err
+	}
+	if t.LastFiredAt.Valid {
+		resp.LastFiredAt = &t.LastFiredAt.Time
+	}
+	if t.LastTransactionID.Valid {
+		lastTransactionID := int(t.LastTransactionID.Int64)
+		resp.LastTransactionID = &lastTransactionID
+	}
+	return resp, nil
+}
+
+const recurringTransactionColumns = `id, schedule, interval_seconds, request, next_fire_at, last_fired_at,
+		last_transaction_id, created_at, updated_at`
+
+func scanRecurringTransaction(row rowScanner) (recurringTransaction, error) {
+	var t recurringTransaction
+	err := row.Scan(
+		&t.ID,
+		&t.Schedule,
+		&t.IntervalSeconds,
+		&t.Request,
+		&t.NextFireAt,
+		&t.LastFiredAt,
+		&t.LastTransactionID,
+		&t.CreatedAt,
+		&t.UpdatedAt,
+	)
+	if err != nil {
+		return recurringTransaction{}, err
+	}
+	return t, nil
+}
+
+func (r SQLRepository) createRecurringTransaction(ctx context.Context, upsert upsertRecurringTransaction) (recurringTransaction, error) {
+	query := `
+		INSERT INTO recurring_transactions (schedule, interval_seconds, request, next_fire_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING ` + recurringTransactionColumns
+
+	stmt, err := r.pool.PrepareContext(ctx, query)
+	if err != nil {
+		return recurringTransaction{}, err
+	}
+	defer logging.LoggedClose(stmt)
+
+	return scanRecurringTransaction(stmt.QueryRowContext(
+		ctx,
+		upsert.Schedule,
+		upsert.IntervalSeconds,
+		upsert.Request,
+		upsert.NextFireAt,
+	))
+}
+
+// replaceRecurringTransaction replaces the definition, and reschedules it from the time of the change. It returns
+// sql.ErrNoRows when the recurring transaction does not exist.
+func (r SQLRepository) replaceRecurringTransaction(ctx context.Context, id int, upsert upsertRecurringTransaction) (recurringTransaction, error) {
+	query := `
+		UPDATE recurring_transactions
+		SET schedule = $2,
+		    interval_seconds = $3,
+		    request = $4,
+		    next_fire_at = $5,
+		    updated_at = now()
+		WHERE id = $1
+		RETURNING ` + recurringTransactionColumns
+
+	stmt, err := r.pool.PrepareContext(ctx, query)
+	if err != nil {
+		return recurringTransaction{}, err
+	}
+	defer logging.LoggedClose(stmt)
+
+	return scanRecurringTransaction(stmt.QueryRowContext(
+		ctx,
+		id,
+		upsert.Schedule,
+		upsert.IntervalSeconds,
+		upsert.Request,
+		upsert.NextFireAt,
+	))
+}
+
+// deleteRecurringTransaction returns sql.ErrNoRows when the recurring transaction does not exist. The transactions it
+// has already enqueued are left as they are.
+func (r SQLRepository) deleteRecurringTransaction(ctx context.Context, id int) error {
+	query := `
+		DELETE FROM recurring_transactions WHERE id = $1 RETURNING id
+	`
+
+	stmt, err := r.pool.PrepareContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer logging.LoggedClose(stmt)
+
+	var deletedID int
+	return stmt.QueryRowContext(ctx, id).Scan(&deletedID)
+}
+
+func (r SQLRepository) fetchRecurringTransaction(ctx context.Context, id int) (recurringTransaction, error) {
+	query := `
+		SELECT ` + recurringTransactionColumns + `
+		FROM recurring_transactions
+		WHERE id = $1
+	`
+
+	stmt, err := r.pool.PrepareContext(ctx, query)
+	if err != nil {
+		return recurringTransaction{}, err
+	}
+	defer logging.LoggedClose(stmt)
+
+	return scanRecurringTransaction(stmt.QueryRowContext(ctx, id))
+}
+
+func (r SQLRepository) fetchRecurringTransactions(ctx context.Context, afterID int, limit int) ([]recurringTransaction, error) {
+	query := `
+		SELECT ` + recurringTransactionColumns + `
+		FROM recurring_transactions
+		WHERE id > $1
+		ORDER BY id
+		LIMIT $2
+	`
+
+	stmt, err := r.pool.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer logging.LoggedClose(stmt)
+
+	rows, err := stmt.QueryContext(ctx, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer logging.LoggedClose(rows)
+
+	return scanRecurringTransactions(rows)
+}
+
+// lockDueRecurringTransactions locks the recurring transactions whose fire time has come. Rows locked by another
+// replica are skipped, so each fire time is materialized by a single replica.
+func (r SQLRepository) lockDueRecurringTransactions(ctx context.Context, tx *sql.Tx, limit int) ([]recurringTransaction, error) {
+	query := `
+		SELECT ` + recurringTransactionColumns + `
+		FROM recurring_transactions
+		WHERE next_fire_at <= now()
+		ORDER BY next_fire_at
+		FOR UPDATE SKIP LOCKED
+		LIMIT $1
+	`
+
+	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer logging.LoggedClose(stmt)
+
+	rows, err := stmt.QueryContext(ctx, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer logging.LoggedClose(rows)
+
+	return scanRecurringTransactions(rows)
+}
+
+// postponeRecurringTransaction moves the fire time on without enqueueing anything, so a recurring transaction which
+// fails to fire does not stay at the head of the due ones.
+func (r SQLRepository) postponeRecurringTransaction(ctx context.Context, tx *sql.Tx, id int, nextFireAt time.Time) error {
+	query := `
+		UPDATE recurring_transactions SET next_fire_at = $2 WHERE id = $1
+	`
+
+	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer logging.LoggedClose(stmt)
+
+	_, err = stmt.ExecContext(ctx, id, nextFireAt)
+	return err
+}
+
+func scanRecurringTransactions(rows *sql.Rows) ([]recurringTransaction, error) {
+	var transactions []recurringTransaction
+	for rows.Next() {
+		t, err := scanRecurringTransaction(rows)
+		if err != nil {
+			return nil, err
+		}
+		transactions = append(transactions, t)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return transactions, nil
+}
+
+// fireRecurringTransaction enqueues the transaction for the current fire time and moves the next fire time on. The
+// idempotency key is derived from the fire time, so a fire time can never be enqueued twice.
+func (r SQLRepository) fireRecurringTransaction(ctx context.Context, tx *sql.Tx, t recurringTransaction, nextFireAt time.Time, carrierJSON string) (int, error) {
+	idempotencyKey := fmt.Sprintf("%s%d-%d", commons.RecurringIdempotencyKeyPrefix, t.ID, t.NextFireAt.Unix())
+	createT, err := newCoordinatedTransaction(t.Request, idempotencyKey, carrierJSON)
+	if err != nil {
+		return 0, err
+	}
+
+	transactionID, created, err := enqueueTransaction(ctx, tx, createT)
+	if err != nil {
+		return 0, err
+	}
+	if created {
+		r.enqueued.hold(tx, createT.Host)
+	}
+
+	query := `
+		UPDATE recurring_transactions
+		SET next_fire_at = $2,
+		    last_fired_at = now(),
+		    last_transaction_id = $3
+		WHERE id = $1
+	`
+
+	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+	defer logging.LoggedClose(stmt)
+
+	if _, err = stmt.ExecContext(ctx, t.ID, nextFireAt, transactionID); err != nil {
+		return 0, err
+	}
+	return transactionID, nil
+}
+
+// scheduler materializes the recurring transactions into ordinary transactions at each of their fire times. Fire
+// times missed while no replica was running are enqueued once, not once per missed fire time.
+type scheduler struct {
+	tracer     trace.Tracer
+	repository Repository
+	config     config.Executor
+}
+
+func (s scheduler) start(ctx context.Context) {
+	ticker := time.NewTicker(s.config.SchedulerInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.fireDueTransactions(ctx); err != nil {
+				slog.Error("encountered error while trying to fire the recurring transactions", "error", err)
+			}
+		}
+	}
+}
+
+func (s scheduler) fireDueTransactions(ctx context.Context) (err error) {
+	ctx, span := s.tracer.Start(ctx, "fireRecurringTransactions")
+	defer span.End()
+
+	span.AddEvent("Trying to begin a sql transaction")
+	tx, err := s.repository.beginTx(ctx, nil)
+	if err != nil {
+		tracing.RecordErr(span, err, "Failed to begin a sql transaction", nil)
+		return err
+	}
+	defer func() {
+		span.AddEvent("Trying to finalize the sql transaction")
+		err = s.repository.finishTx(tx, err)
+		if err != nil {
+			tracing.RecordErr(span, err, "Failed to finalize the sql transaction", nil)
+		}
+	}()
+
+	due, err := s.repository.lockDueRecurringTransactions(ctx, tx, s.config.BatchSize)
+	if err != nil {
+		tracing.RecordErr(span, err, "Failed to lock the due recurring transactions", nil)
+		return err
+	}
+	if len(due) == 0 {
+		return nil
+	}
+
+	carrierJSON, err := tracing.MarshalContext(ctx)
+	if err != nil {
+		tracing.RecordErr(span, err, "Failed to marshal the trace context", nil)
+		return err
+	}
+
+	now := time.Now()
+	for _, t := range due {
+		// Each recurring transaction is fired within its own savepoint, so a broken one does not hold back the others.
+		var transactionID int
+		err = s.repository.withSavepoint(ctx, tx, func() error {
+			schedule, err := t.schedule()
+			if err != nil {
+				return err
+			}
+			transactionID, err = s.repository.fireRecurringTransaction(ctx, tx, t, schedule.Next(now), carrierJSON)
+			return err
+		})
+		if err != nil {
+			tracing.RecordErr(span, err, "Failed to fire the recurring transaction, postponing it", trace.WithAttributes(
+				attribute.Int("recurring transaction id", t.ID),
+			))
+			if err = s.repository.postponeRecurringTransaction(ctx, tx, t.ID, now.Add(recurringFailureDelay)); err != nil {
+				tracing.RecordErr(span, err, "Failed to postpone the recurring transaction", nil)
+				return err
+			}
+			continue
+		}
+		span.AddEvent("Fired the recurring transaction", trace.WithAttributes(
+			attribute.Int("recurring transaction id", t.ID),
+			attribute.Int("transaction id", transactionID),
+		))
+	}
+	return nil
+}
+
+// recurringFailureDelay is how long a recurring transaction which has failed to fire waits before it is tried again.
+const recurringFailureDelay = time.Minute
@@ -0,0 +1,59 @@
+package transaction
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseSchedule(t *testing.T) {
+	now := time.Date(2025, 3, 10, 12, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		schedule string
+		interval time.Duration
+		next     time.Time
+		wantErr  bool
+	}{
+		{
+			name:     "cron expression in UTC",
+			schedule: "0 2 * * *",
+			next:     time.Date(2025, 3, 11, 2, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "descriptor in UTC",
+			schedule: "@daily",
+			next:     time.Date(2025, 3, 11, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "cron expression in an explicit time zone",
+			schedule: "CRON_TZ=Asia/Tokyo 0 2 * * *",
+			next:     time.Date(2025, 3, 10, 17, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "interval",
+			interval: 90 * time.Second,
+			next:     now.Add(90 * time.Second),
+		},
+		{
+			name:     "invalid cron expression",
+			schedule: "0 2 * *",
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := parseSchedule(tt.schedule, tt.interval)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseSchedule() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if next := s.Next(now); !next.Equal(tt.next) {
+				t.Errorf("Next() = %v, want %v", next, tt.next)
+			}
+		})
+	}
+}
@@ -3,17 +3,28 @@ package transaction
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
+	"github.com/mat-sik/sql-distributed-transactions/server/internal/logging"
 	"io"
 	"net/http"
+	"strings"
+
+	commons "github.com/mat-sik/sql-distributed-transactions/common/transaction"
 )
 
 type remoteClient struct {
-	client *http.Client
+	client      *http.Client
+	maxBodySize int
 }
 
-func (c remoteClient) tryExecRemoteTransaction(ctx context.Context, t transaction) (*http.Response, error) {
+// tryExecRemoteTransaction sends the transaction and reads up to maxBodySize bytes of the response body. The body is
+// always closed, so the connection can be reused.
+func (c remoteClient) tryExecRemoteTransaction(ctx context.Context, t transaction) (remoteResponse, error) {
 	url := getUnsecureURL(t.Host, t.Path)
+	if t.Scheme == "https" {
+		url = getSecureURL(t.Host, t.Path)
+	}
 
 	var body io.Reader
 	if t.Payload.Valid {
@@ -22,13 +33,60 @@ func (c remoteClient) tryExecRemoteTransaction(ctx context.Context, t transactio
 
 	req, err := http.NewRequestWithContext(ctx, t.Method, url, body)
 	if err != nil {
-		return nil, err
+		return remoteResponse{}, err
 	}
-	if body != nil {
+	if t.Headers.Valid {
+		var headers map[string]string
+		if err = json.Unmarshal([]byte(t.Headers.String), &headers); err != nil {
+			return remoteResponse{}, fmt.Errorf("failed to parse the transaction headers: %w", err)
+		}
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+	}
+	if t.ContentType.Valid {
+		req.Header.Set("Content-Type", t.ContentType.String)
+	} else if body != nil {
 		req.Header.Set("Content-Type", "application/json")
 	}
+	if t.IdempotencyKey.Valid {
+		req.Header.Set(commons.IdempotencyKeyHeader, t.deliveryIdempotencyKey())
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return remoteResponse{}, err
+	}
+	defer logging.LoggedClose(resp.Body)
+
+	respBody, bodyErr := readBody(resp.Body, c.maxBodySize)
+	return remoteResponse{
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header,
+		Body:       respBody,
+		BodyErr:    bodyErr,
+	}, nil
+}
+
+type remoteResponse struct {
+	StatusCode int
+	Header     http.Header
+	Body       string
+	BodyErr    error
+}
+
+func readBody(body io.Reader, maxBodySize int) (string, error) {
+	data, err := io.ReadAll(io.LimitReader(body, int64(maxBodySize)))
+	if err != nil {
+		return "", err
+	}
+	if _, err = io.Copy(io.Discard, io.LimitReader(body, maxDrainedBodySize)); err != nil {
+		return "", err
+	}
 
-	return c.client.Do(req)
+	// Postgres text columns accept neither invalid UTF-8 nor NUL characters.
+	text := strings.ToValidUTF8(string(data), "\uFFFD")
+	return strings.ReplaceAll(text, "\x00", ""), nil
 }
 
 func getSecureURL(host string, path string) string {
@@ -38,3 +96,6 @@ func getSecureURL(host string, path string) string {
 func getUnsecureURL(host string, path string) string {
 	return fmt.Sprintf("http://%s%s", host, path)
 }
+
+// maxDrainedBodySize bounds how much of the remaining response body is discarded to keep the connection reusable.
+const maxDrainedBodySize = 256 << 10
@@ -0,0 +1,119 @@
+package transaction
+
+import (
+	"context"
+	"github.com/mat-sik/sql-distributed-transactions/server/internal/logging"
+
+	commons "github.com/mat-sik/sql-distributed-transactions/common/transaction"
+)
+
+// replayableCondition matches the finished transactions. The calls of sagas and two-phase commits are left out, since
+// their outcomes have already been acted upon by their coordinators.
+const replayableCondition = `state IN ('DONE', 'FAILED', 'EXPIRED', 'CANCELLED')
+		  AND saga_id IS NULL
+		  AND two_phase_commit_id IS NULL`
+
+func (r SQLRepository) countReplayableTransactions(ctx context.Context, filter transactionFilter, afterID int) (int, error) {
+	where, args := filter.where([]any{afterID})
+	query := `
+		SELECT count(*)
+		FROM transactions
+		WHERE id > $1
+		  AND ` + replayableCondition + `
+		  AND ` + where + `
+	`
+
+	stmt, err := r.pool.PrepareContext(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+	defer logging.LoggedClose(stmt)
+
+	var count int
+	err = stmt.QueryRowContext(ctx, args...).Scan(&count)
+	return count, err
+}
+
+// replayTransactions replays up to limit matching transactions with IDs above afterID, in the order of their IDs. It
+// returns the IDs of the transactions to be delivered again, and the ID of the last matching transaction. Replayed
+// transactions get a fresh attempt counter and lose their deadline. Each reset counts as a replay, so the transaction is
+// delivered with an idempotency key of its own. The copies made by the clone mode have no idempotency key, since the
+// original already holds it.
+func (r SQLRepository) replayTransactions(ctx context.Context, filter transactionFilter, mode string, afterID int, limit int) (ids []int, lastMatchedID int, err error) {
+	where, args := filter.where([]any{afterID, limit})
+	source := `
+		SELECT *
+		FROM transactions
+		WHERE id > $1
+		  AND ` + replayableCondition + `
+		  AND ` + where + `
+		ORDER BY id
+		LIMIT $2
+		FOR UPDATE SKIP LOCKED
+	`
+
+	replayed := `
+		UPDATE transactions
+		SET state = 'PENDING',
+		    attempts = 0,
+		    replays = replays + 1,
+		    next_attempt_at = now(),
+		    expires_at = NULL,
+		    updated_at = now()
+		WHERE id IN (SELECT id FROM source)
+		RETURNING id, host
+	`
+	if mode == commons.ReplayModeClone {
+		replayed = `
+			INSERT INTO transactions (
+				scheme, host, path, method, payload, state, carrier_json, max_attempts, response_policy, headers,
+				content_type, ordering_key, priority
+			)
+			SELECT scheme, host, path, method, payload, 'PENDING', carrier_json, max_attempts, response_policy, headers,
+			       content_type, ordering_key, priority
+			FROM source
+			ORDER BY id
+			RETURNING id, host
+		`
+	}
+
+	query := `
+		WITH source AS (` + source + `), replayed AS (` + replayed + `)
+		SELECT replayed.id, replayed.host, (SELECT max(id) FROM source)
+		FROM replayed
+		ORDER BY replayed.id
+	`
+
+	stmt, err := r.pool.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer logging.LoggedClose(stmt)
+
+	rows, err := stmt.QueryContext(ctx, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer logging.LoggedClose(rows)
+
+	var hosts []string
+	for rows.Next() {
+		var id int
+		var host string
+		if err = rows.Scan(&id, &host, &lastMatchedID); err != nil {
+			return nil, 0, err
+		}
+		if mode == commons.ReplayModeClone {
+			hosts = append(hosts, host)
+		}
+		ids = append(ids, id)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, 0, err
+	}
+	// The statement has committed on its own once all of its rows have been read.
+	r.enqueued.record(ctx, hosts...)
+
+	return ids, lastMatchedID, nil
+}
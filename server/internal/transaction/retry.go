@@ -0,0 +1,30 @@
+package transaction
+
+import (
+	"math/rand/v2"
+	"time"
+)
+
+type retryPolicy struct {
+	baseDelay time.Duration
+	maxDelay  time.Duration
+}
+
+// delay returns how long to wait before the next attempt after the given number of failed attempts. The delay grows
+// exponentially from baseDelay up to maxDelay, and a random half of it is jittered away, so that transactions which
+// failed together do not all come back at the same time.
+func (p retryPolicy) delay(failedAttempts int) time.Duration {
+	if p.baseDelay <= 0 {
+		return 0
+	}
+
+	d := p.maxDelay
+	if shift := failedAttempts - 1; shift < 32 {
+		if exp := p.baseDelay << max(shift, 0); exp > 0 && exp < p.maxDelay {
+			d = exp
+		}
+	}
+
+	half := d / 2
+	return half + rand.N(d-half+1)
+}
@@ -0,0 +1,37 @@
+package transaction
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyDelay(t *testing.T) {
+	policy := retryPolicy{baseDelay: time.Second, maxDelay: time.Minute}
+
+	tests := []struct {
+		name           string
+		policy         retryPolicy
+		failedAttempts int
+		want           time.Duration
+	}{
+		{name: "no base delay", policy: retryPolicy{maxDelay: time.Minute}, failedAttempts: 3, want: 0},
+		{name: "no failed attempts", policy: policy, failedAttempts: 0, want: time.Second},
+		{name: "first failed attempt", policy: policy, failedAttempts: 1, want: time.Second},
+		{name: "third failed attempt", policy: policy, failedAttempts: 3, want: 4 * time.Second},
+		{name: "last attempt below the cap", policy: policy, failedAttempts: 6, want: 32 * time.Second},
+		{name: "capped", policy: policy, failedAttempts: 7, want: time.Minute},
+		{name: "capped when the shift overflows", policy: policy, failedAttempts: 64, want: time.Minute},
+		{name: "base delay above the cap", policy: retryPolicy{baseDelay: time.Hour, maxDelay: time.Minute}, failedAttempts: 1, want: time.Minute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The jitter takes away a random part of up to half of the delay.
+			for range 100 {
+				if got := tt.policy.delay(tt.failedAttempts); got < tt.want/2 || got > tt.want {
+					t.Fatalf("delay(%d) = %v, want within [%v, %v]", tt.failedAttempts, got, tt.want/2, tt.want)
+				}
+			}
+		})
+	}
+}
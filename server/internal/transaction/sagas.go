@@ -0,0 +1,440 @@
+package transaction
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/mat-sik/sql-distributed-transactions/server/internal/logging"
+	"time"
+
+	commons "github.com/mat-sik/sql-distributed-transactions/common/transaction"
+)
+
+// A saga runs its steps one at a time. Each forward and compensating call is sent as a regular transaction, created
+// only once the saga reaches it, and the saga advances in the same sql transaction which records the call outcome.
+
+type sagaState string
+
+const (
+	sagaRunning      sagaState = "RUNNING"
+	sagaCompensating sagaState = "COMPENSATING"
+	sagaCompleted    sagaState = "COMPLETED"
+	sagaCompensated  sagaState = "COMPENSATED"
+	// sagaFailed means that a compensation has failed, which leaves the saga for an operator to resolve.
+	sagaFailed sagaState = "FAILED"
+)
+
+type sagaStepState string
+
+const (
+	stepPending            sagaStepState = "PENDING"
+	stepRunning            sagaStepState = "RUNNING"
+	stepDone               sagaStepState = "DONE"
+	stepFailed             sagaStepState = "FAILED"
+	stepCompensating       sagaStepState = "COMPENSATING"
+	stepCompensated        sagaStepState = "COMPENSATED"
+	stepCompensationFailed sagaStepState = "COMPENSATION_FAILED"
+)
+
+type createSaga struct {
+	Steps       []createSagaStep
+	carrierJSON string
+}
+
+// createSagaStep holds the calls of a step as JSON encoded commons.EnqueueTransactionRequest.
+type createSagaStep struct {
+	ForwardRequest      string
+	CompensationRequest sql.NullString
+}
+
+func newCreateSaga(req commons.EnqueueSagaRequest, carrierJSON string) (createSaga, error) {
+	saga := createSaga{
+		Steps:       make([]createSagaStep, 0, len(req.Steps)),
+		carrierJSON: carrierJSON,
+	}
+	for _, step := range req.Steps {
+		forward, err := json.Marshal(step.Forward)
+		if err != nil {
+			return createSaga{}, err
+		}
+
+		var compensation sql.NullString
+		if step.Compensation != nil {
+			encoded, err := json.Marshal(step.Compensation)
+			if err != nil {
+				return createSaga{}, err
+			}
+			compensation = sql.NullString{
+				String: string(encoded),
+				Valid:  true,
+			}
+		}
+
+		saga.Steps = append(saga.Steps, createSagaStep{
+			ForwardRequest:      string(forward),
+			CompensationRequest: compensation,
+		})
+	}
+	return saga, nil
+}
+
+// createSaga inserts the saga with its steps and enqueues the forward call of the first step.
+func (r SQLRepository) createSaga(ctx context.Context, createSaga createSaga) (id int, err error) {
+	tx, err := r.beginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		err = r.finishTx(tx, err)
+	}()
+
+	query := `
+		INSERT INTO sagas (state, carrier_json) VALUES ($1, $2) RETURNING id
+	`
+
+	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+	defer logging.LoggedClose(stmt)
+
+	if err = stmt.QueryRowContext(ctx, sagaRunning, createSaga.carrierJSON).Scan(&id); err != nil {
+		return 0, err
+	}
+
+	stepQuery := `
+		INSERT INTO saga_steps (saga_id, position, state, forward_request, compensation_request)
+		VALUES ($1, $2, $3, $4, $5)
+	`
+
+	stepStmt, err := tx.PrepareContext(ctx, stepQuery)
+	if err != nil {
+		return 0, err
+	}
+	defer logging.LoggedClose(stepStmt)
+
+	for position, step := range createSaga.Steps {
+		if _, err = stepStmt.ExecContext(
+			ctx,
+			id,
+			position,
+			stepPending,
+			step.ForwardRequest,
+			step.CompensationRequest,
+		); err != nil {
+			return 0, err
+		}
+	}
+
+	if _, err = r.startSagaStep(ctx, tx, id, 0, createSaga.carrierJSON); err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+// advanceSaga moves the saga on after one of its transactions has reached a terminal state. A succeeded forward call
+// starts the next step, while any other outcome starts compensating the completed steps, latest first. A compensation
+// which fails stops the saga, but if an operator requeues it and it succeeds, the compensation carries on.
+func (r SQLRepository) advanceSaga(ctx context.Context, tx *sql.Tx, transactionID int, outcome state) error {
+	query := `
+		SELECT s.saga_id, s.position, s.forward_transaction_id = $1, g.carrier_json, t.last_status_code
+		FROM saga_steps s
+		JOIN sagas g ON g.id = s.saga_id
+		JOIN transactions t ON t.id = $1
+		WHERE s.forward_transaction_id = $1 OR s.compensation_transaction_id = $1
+		FOR UPDATE OF g
+	`
+
+	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer logging.LoggedClose(stmt)
+
+	var sagaID, position int
+	var forward bool
+	var carrierJSON string
+	var statusCode sql.NullInt32
+	if err = stmt.QueryRowContext(ctx, transactionID).Scan(&sagaID, &position, &forward, &carrierJSON, &statusCode); err != nil {
+		return err
+	}
+
+	switch {
+	case forward && forwardStepSucceeded(outcome, statusCode):
+		if err = updateSagaStepState(ctx, tx, sagaID, position, stepDone); err != nil {
+			return err
+		}
+		started, err := r.startSagaStep(ctx, tx, sagaID, position+1, carrierJSON)
+		if err != nil || started {
+			return err
+		}
+		return updateSagaState(ctx, tx, sagaID, sagaCompleted)
+	case forward:
+		if err = updateSagaStepState(ctx, tx, sagaID, position, stepFailed); err != nil {
+			return err
+		}
+		return r.compensateSaga(ctx, tx, sagaID, position, carrierJSON)
+	case outcome == DONE:
+		if err = updateSagaStepState(ctx, tx, sagaID, position, stepCompensated); err != nil {
+			return err
+		}
+		return r.compensateSaga(ctx, tx, sagaID, position, carrierJSON)
+	default:
+		if err = updateSagaStepState(ctx, tx, sagaID, position, stepCompensationFailed); err != nil {
+			return err
+		}
+		return updateSagaState(ctx, tx, sagaID, sagaFailed)
+	}
+}
+
+// forwardStepSucceeded reports whether the forward call of a step has succeeded. Only a 2xx response counts, whatever
+// the response policy of the call makes of the others, as with the prepare calls of a two-phase commit.
+func forwardStepSucceeded(outcome state, statusCode sql.NullInt32) bool {
+	return outcome == DONE && statusCode.Valid && statusCode.Int32 >= 200 && statusCode.Int32 < 300
+}
+
+// startSagaStep enqueues the forward call of the step at the given position. It reports false when the saga has no
+// such step.
+func (r SQLRepository) startSagaStep(ctx context.Context, tx *sql.Tx, sagaID int, position int, carrierJSON string) (bool, error) {
+	query := `
+		SELECT forward_request FROM saga_steps WHERE saga_id = $1 AND position = $2
+	`
+
+	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		return false, err
+	}
+	defer logging.LoggedClose(stmt)
+
+	var forwardRequest string
+	err = stmt.QueryRowContext(ctx, sagaID, position).Scan(&forwardRequest)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	transactionID, err := r.insertSagaTransaction(ctx, tx, sagaID, forwardRequest, sagaIdempotencyKey(sagaID, position, "forward"), carrierJSON)
+	if err != nil {
+		return false, err
+	}
+
+	updateQuery := `
+		UPDATE saga_steps SET state = $3, forward_transaction_id = $4 WHERE saga_id = $1 AND position = $2
+	`
+
+	updateStmt, err := tx.PrepareContext(ctx, updateQuery)
+	if err != nil {
+		return false, err
+	}
+	defer logging.LoggedClose(updateStmt)
+
+	if _, err = updateStmt.ExecContext(ctx, sagaID, position, stepRunning, transactionID); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// compensateSaga enqueues the compensating call of the latest completed step before the given position, or marks the
+// saga as compensated when there is nothing left to compensate.
+func (r SQLRepository) compensateSaga(ctx context.Context, tx *sql.Tx, sagaID int, before int, carrierJSON string) error {
+	query := `
+		SELECT position, compensation_request
+		FROM saga_steps
+		WHERE saga_id = $1 AND position < $2 AND state = $3 AND compensation_request IS NOT NULL
+		ORDER BY position DESC
+		LIMIT 1
+	`
+
+	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer logging.LoggedClose(stmt)
+
+	var position int
+	var compensationRequest string
+	err = stmt.QueryRowContext(ctx, sagaID, before, stepDone).Scan(&position, &compensationRequest)
+	if errors.Is(err, sql.ErrNoRows) {
+		return updateSagaState(ctx, tx, sagaID, sagaCompensated)
+	}
+	if err != nil {
+		return err
+	}
+
+	transactionID, err := r.insertSagaTransaction(ctx, tx, sagaID, compensationRequest, sagaIdempotencyKey(sagaID, position, "compensation"), carrierJSON)
+	if err != nil {
+		return err
+	}
+
+	updateQuery := `
+		UPDATE saga_steps SET state = $3, compensation_transaction_id = $4 WHERE saga_id = $1 AND position = $2
+	`
+
+	updateStmt, err := tx.PrepareContext(ctx, updateQuery)
+	if err != nil {
+		return err
+	}
+	defer logging.LoggedClose(updateStmt)
+
+	if _, err = updateStmt.ExecContext(ctx, sagaID, position, stepCompensating, transactionID); err != nil {
+		return err
+	}
+	return updateSagaState(ctx, tx, sagaID, sagaCompensating)
+}
+
+func (r SQLRepository) insertSagaTransaction(ctx context.Context, tx *sql.Tx, sagaID int, requestJSON string, idempotencyKey string, carrierJSON string) (int, error) {
+	createT, err := newCoordinatedTransaction(requestJSON, idempotencyKey, carrierJSON)
+	if err != nil {
+		return 0, err
+	}
+	createT.SagaID = sql.NullInt64{
+		Int64: int64(sagaID),
+		Valid: true,
+	}
+	return r.insertHeldTransaction(ctx, tx, createT)
+}
+
+// newCoordinatedTransaction prepares a call stored as JSON encoded commons.EnqueueTransactionRequest.
+func newCoordinatedTransaction(requestJSON string, idempotencyKey string, carrierJSON string) (createTransaction, error) {
+	var req commons.EnqueueTransactionRequest
+	if err := json.Unmarshal([]byte(requestJSON), &req); err != nil {
+		return createTransaction{}, err
+	}
+	req.IdempotencyKey = idempotencyKey
+	return newCreateTransaction(req, carrierJSON)
+}
+
+// sagaIdempotencyKey identifies a call of a saga step, so the downstream can recognize it across the attempts.
+func sagaIdempotencyKey(sagaID int, position int, call string) string {
+	return fmt.Sprintf("%s%d-%d-%s", commons.SagaIdempotencyKeyPrefix, sagaID, position, call)
+}
+
+func updateSagaStepState(ctx context.Context, tx *sql.Tx, sagaID int, position int, s sagaStepState) error {
+	query := `
+		UPDATE saga_steps SET state = $3 WHERE saga_id = $1 AND position = $2
+	`
+
+	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer logging.LoggedClose(stmt)
+
+	_, err = stmt.ExecContext(ctx, sagaID, position, s)
+	return err
+}
+
+func updateSagaState(ctx context.Context, tx *sql.Tx, sagaID int, s sagaState) error {
+	query := `
+		UPDATE sagas SET state = $2, updated_at = now() WHERE id = $1
+	`
+
+	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer logging.LoggedClose(stmt)
+
+	_, err = stmt.ExecContext(ctx, sagaID, s)
+	return err
+}
+
+func (r SQLRepository) fetchSaga(ctx context.Context, id int) (sagaStatus, error) {
+	query := `
+		SELECT id, state, created_at, updated_at FROM sagas WHERE id = $1
+	`
+
+	stmt, err := r.pool.PrepareContext(ctx, query)
+	if err != nil {
+		return sagaStatus{}, err
+	}
+	defer logging.LoggedClose(stmt)
+
+	var saga sagaStatus
+	if err = stmt.QueryRowContext(ctx, id).Scan(&saga.ID, &saga.State, &saga.CreatedAt, &saga.UpdatedAt); err != nil {
+		return sagaStatus{}, err
+	}
+
+	stepsQuery := `
+		SELECT position, state, forward_transaction_id, compensation_transaction_id
+		FROM saga_steps
+		WHERE saga_id = $1
+		ORDER BY position
+	`
+
+	stepsStmt, err := r.pool.PrepareContext(ctx, stepsQuery)
+	if err != nil {
+		return sagaStatus{}, err
+	}
+	defer logging.LoggedClose(stepsStmt)
+
+	rows, err := stepsStmt.QueryContext(ctx, id)
+	if err != nil {
+		return sagaStatus{}, err
+	}
+	defer logging.LoggedClose(rows)
+
+	for rows.Next() {
+		var step sagaStepStatus
+		if err = rows.Scan(
+			&step.Position,
+			&step.State,
+			&step.ForwardTransactionID,
+			&step.CompensationTransactionID,
+		); err != nil {
+			return sagaStatus{}, err
+		}
+		saga.Steps = append(saga.Steps, step)
+	}
+
+	if err = rows.Err(); err != nil {
+		return sagaStatus{}, err
+	}
+
+	return saga, nil
+}
+
+type sagaStatus struct {
+	ID        int
+	State     sagaState
+	Steps     []sagaStepStatus
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+type sagaStepStatus struct {
+	Position                  int
+	State                     sagaStepState
+	ForwardTransactionID      sql.NullInt64
+	CompensationTransactionID sql.NullInt64
+}
+
+func (s sagaStatus) toResponse() commons.Saga {
+	resp := commons.Saga{
+		ID:        s.ID,
+		State:     string(s.State),
+		Steps:     make([]commons.SagaStep, 0, len(s.Steps)),
+		CreatedAt: s.CreatedAt,
+		UpdatedAt: s.UpdatedAt,
+	}
+	for _, step := range s.Steps {
+		stepResp := commons.SagaStep{
+			Position: step.Position,
+			State:    string(step.State),
+		}
+		if step.ForwardTransactionID.Valid {
+			forwardID := int(step.ForwardTransactionID.Int64)
+			stepResp.ForwardTransactionID = &forwardID
+		}
+		if step.CompensationTransactionID.Valid {
+			compensationID := int(step.CompensationTransactionID.Int64)
+			stepResp.CompensationTransactionID = &compensationID
+		}
+		resp.Steps = append(resp.Steps, stepResp)
+	}
+	return resp
+}
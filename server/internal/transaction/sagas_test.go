@@ -0,0 +1,36 @@
+package transaction
+
+import (
+	"database/sql"
+	"testing"
+)
+
+func TestForwardStepSucceeded(t *testing.T) {
+	statusCode := func(code int32) sql.NullInt32 {
+		return sql.NullInt32{Int32: code, Valid: true}
+	}
+
+	tests := []struct {
+		name       string
+		outcome    state
+		statusCode sql.NullInt32
+		want       bool
+	}{
+		{name: "done with a 200", outcome: DONE, statusCode: statusCode(200), want: true},
+		{name: "done with a 204", outcome: DONE, statusCode: statusCode(204), want: true},
+		{name: "done with a 4xx", outcome: DONE, statusCode: statusCode(404), want: false},
+		{name: "done with a 3xx", outcome: DONE, statusCode: statusCode(302), want: false},
+		{name: "done without a status code", outcome: DONE, want: false},
+		{name: "failed", outcome: FAILED, statusCode: statusCode(500), want: false},
+		{name: "expired", outcome: EXPIRED, want: false},
+		{name: "cancelled", outcome: CANCELLED, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := forwardStepSucceeded(tt.outcome, tt.statusCode); got != tt.want {
+				t.Errorf("forwardStepSucceeded() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,161 @@
+package transaction
+
+import (
+	"context"
+	"database/sql"
+)
+
+func CreateTransactionsTableIfNotExist(ctx context.Context, pool *sql.DB) error {
+	queries := []string{
+		`
+		CREATE TABLE IF NOT EXISTS transactions (
+    	id BIGSERIAL NOT NULL,
+    	host TEXT NOT NULL,
+    	path TEXT NOT NULL,
+    	method TEXT NOT NULL,
+    	payload TEXT NULL,
+    	state TEXT NOT NULL,
+    	created_at TIMESTAMP DEFAULT now(),
+		carrier_json TEXT NOT NULL,
+    	PRIMARY KEY (id)
+		)
+		`,
+		`ALTER TABLE transactions ADD COLUMN IF NOT EXISTS attempts INT NOT NULL DEFAULT 0`,
+		`ALTER TABLE transactions ADD COLUMN IF NOT EXISTS last_status_code INT NULL`,
+		`ALTER TABLE transactions ADD COLUMN IF NOT EXISTS last_attempt_at TIMESTAMPTZ NULL`,
+		`ALTER TABLE transactions ADD COLUMN IF NOT EXISTS updated_at TIMESTAMPTZ NOT NULL DEFAULT now()`,
+		`ALTER TABLE transactions ADD COLUMN IF NOT EXISTS idempotency_key TEXT NULL`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS transactions_idempotency_key_idx ON transactions (idempotency_key)`,
+		`ALTER TABLE transactions ADD COLUMN IF NOT EXISTS max_attempts INT NULL`,
+		`CREATE INDEX IF NOT EXISTS transactions_state_idx ON transactions (state, id)`,
+		`ALTER TABLE transactions ADD COLUMN IF NOT EXISTS next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT now()`,
+		`CREATE INDEX IF NOT EXISTS transactions_state_next_attempt_at_idx ON transactions (state, next_attempt_at)`,
+		`ALTER TABLE transactions ADD COLUMN IF NOT EXISTS leased_by TEXT NULL`,
+		`ALTER TABLE transactions ADD COLUMN IF NOT EXISTS lease_expires_at TIMESTAMPTZ NULL`,
+		`CREATE INDEX IF NOT EXISTS transactions_lease_expires_at_idx ON transactions (lease_expires_at) WHERE state = 'IN_FLIGHT'`,
+		`ALTER TABLE transactions ADD COLUMN IF NOT EXISTS response_policy TEXT NULL`,
+		`
+		CREATE TABLE IF NOT EXISTS transaction_attempts (
+		id BIGSERIAL NOT NULL,
+		transaction_id BIGINT NOT NULL REFERENCES transactions (id) ON DELETE CASCADE,
+		attempt INT NOT NULL,
+		started_at TIMESTAMPTZ NOT NULL,
+		finished_at TIMESTAMPTZ NOT NULL,
+		status_code INT NULL,
+		response_headers TEXT NULL,
+		response_body TEXT NULL,
+		error TEXT NULL,
+		PRIMARY KEY (id)
+		)
+		`,
+		`CREATE INDEX IF NOT EXISTS transaction_attempts_transaction_id_idx ON transaction_attempts (transaction_id)`,
+		`ALTER TABLE transactions ADD COLUMN IF NOT EXISTS headers TEXT NULL`,
+		`ALTER TABLE transactions ADD COLUMN IF NOT EXISTS content_type TEXT NULL`,
+		`ALTER TABLE transactions ADD COLUMN IF NOT EXISTS scheme TEXT NOT NULL DEFAULT 'http'`,
+		`
+		CREATE TABLE IF NOT EXISTS sagas (
+		id BIGSERIAL NOT NULL,
+		state TEXT NOT NULL,
+		carrier_json TEXT NOT NULL,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+		updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+		PRIMARY KEY (id)
+		)
+		`,
+		`
+		CREATE TABLE IF NOT EXISTS saga_steps (
+		saga_id BIGINT NOT NULL REFERENCES sagas (id) ON DELETE CASCADE,
+		position INT NOT NULL,
+		state TEXT NOT NULL,
+		forward_request TEXT NOT NULL,
+		compensation_request TEXT NULL,
+		forward_transaction_id BIGINT NULL REFERENCES transactions (id),
+		compensation_transaction_id BIGINT NULL REFERENCES transactions (id),
+		PRIMARY KEY (saga_id, position)
+		)
+		`,
+		`CREATE INDEX IF NOT EXISTS saga_steps_forward_transaction_id_idx ON saga_steps (forward_transaction_id)`,
+		`CREATE INDEX IF NOT EXISTS saga_steps_compensation_transaction_id_idx ON saga_steps (compensation_transaction_id)`,
+		`ALTER TABLE transactions ADD COLUMN IF NOT EXISTS saga_id BIGINT NULL REFERENCES sagas (id)`,
+		`
+		CREATE TABLE IF NOT EXISTS two_phase_commits (
+		id BIGSERIAL NOT NULL,
+		state TEXT NOT NULL,
+		decision TEXT NULL,
+		decided_at TIMESTAMPTZ NULL,
+		carrier_json TEXT NOT NULL,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+		updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+		PRIMARY KEY (id)
+		)
+		`,
+		`CREATE INDEX IF NOT EXISTS two_phase_commits_state_idx ON two_phase_commits (state, id)`,
+		`
+		CREATE TABLE IF NOT EXISTS two_phase_commit_participants (
+		two_phase_commit_id BIGINT NOT NULL REFERENCES two_phase_commits (id) ON DELETE CASCADE,
+		position INT NOT NULL,
+		prepare_request TEXT NOT NULL,
+		commit_request TEXT NOT NULL,
+		abort_request TEXT NOT NULL,
+		prepare_transaction_id BIGINT NOT NULL REFERENCES transactions (id),
+		commit_transaction_id BIGINT NULL REFERENCES transactions (id),
+		abort_transaction_id BIGINT NULL REFERENCES transactions (id),
+		PRIMARY KEY (two_phase_commit_id, position)
+		)
+		`,
+		`CREATE INDEX IF NOT EXISTS two_phase_commit_participants_prepare_transaction_id_idx ON two_phase_commit_participants (prepare_transaction_id)`,
+		`ALTER TABLE transactions ADD COLUMN IF NOT EXISTS two_phase_commit_id BIGINT NULL REFERENCES two_phase_commits (id)`,
+		`ALTER TABLE transactions ADD COLUMN IF NOT EXISTS ordering_key TEXT NULL`,
+		`ALTER TABLE transactions ADD COLUMN IF NOT EXISTS expires_at TIMESTAMPTZ NULL`,
+		`ALTER TABLE transactions ADD COLUMN IF NOT EXISTS priority INTEGER NOT NULL DEFAULT 0`,
+		`ALTER TABLE transactions ADD COLUMN IF NOT EXISTS replays INTEGER NOT NULL DEFAULT 0`,
+		`
+		CREATE TABLE IF NOT EXISTS rate_limit_buckets (
+		key TEXT NOT NULL,
+		tokens DOUBLE PRECISION NOT NULL,
+		refilled_at TIMESTAMPTZ NOT NULL,
+		PRIMARY KEY (key)
+		)
+		`,
+		`
+		CREATE TABLE IF NOT EXISTS recurring_transactions (
+		id BIGSERIAL NOT NULL,
+		schedule TEXT NULL,
+		interval_seconds DOUBLE PRECISION NULL,
+		request TEXT NOT NULL,
+		next_fire_at TIMESTAMPTZ NOT NULL,
+		last_fired_at TIMESTAMPTZ NULL,
+		last_transaction_id BIGINT NULL,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+		updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+		PRIMARY KEY (id)
+		)
+		`,
+		`CREATE INDEX IF NOT EXISTS recurring_transactions_next_fire_at_idx ON recurring_transactions (next_fire_at)`,
+		`
+		CREATE INDEX IF NOT EXISTS transactions_ordering_key_idx ON transactions (ordering_key, id)
+		WHERE ordering_key IS NOT NULL AND state IN ('PENDING', 'RETRY', 'IN_FLIGHT')
+		`,
+		`
+		CREATE OR REPLACE FUNCTION notify_transactions_ready() RETURNS trigger AS $$
+		BEGIN
+			PERFORM pg_notify('transactions_ready', '');
+			RETURN NULL;
+		END;
+		$$ LANGUAGE plpgsql
+		`,
+		`
+		CREATE OR REPLACE TRIGGER transactions_notify_ready
+		AFTER INSERT OR UPDATE OF state, next_attempt_at ON transactions
+		FOR EACH ROW WHEN (NEW.state IN ('PENDING', 'RETRY') AND NEW.next_attempt_at <= now())
+		EXECUTE FUNCTION notify_transactions_ready()
+		`,
+	}
+
+	for _, query := range queries {
+		if _, err := pool.ExecContext(ctx, query); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package transaction
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"github.com/mat-sik/sql-distributed-transactions/server/internal/config"
+	"net/http"
+	"os"
+)
+
+// NewRemoteTransport returns the transport used for the remote calls. Hosts listed in a TLS profile get a transport
+// of their own, every other host shares the default one. The configuration is expected to have been validated by
+// config.NewTLSConfig.
+func NewRemoteTransport(tlsConfig config.TLS) (http.RoundTripper, error) {
+	defaultTransport, err := newTLSTransport(tlsConfig.Default.Profile())
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure the default TLS profile: %w", err)
+	}
+
+	byHost := make(map[string]http.RoundTripper)
+	for name, profile := range tlsConfig.Profiles {
+		transport, err := newTLSTransport(profile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to configure the %s TLS profile: %w", name, err)
+		}
+		for _, host := range profile.Hosts {
+			byHost[host] = transport
+		}
+	}
+
+	return hostTransport{
+		defaultTransport: defaultTransport,
+		byHost:           byHost,
+	}, nil
+}
+
+// hostTransport routes a request by its host with the port, then by its host alone.
+type hostTransport struct {
+	defaultTransport http.RoundTripper
+	byHost           map[string]http.RoundTripper
+}
+
+func (t hostTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if transport, ok := t.byHost[req.URL.Host]; ok {
+		return transport.RoundTrip(req)
+	}
+	if transport, ok := t.byHost[req.URL.Hostname()]; ok {
+		return transport.RoundTrip(req)
+	}
+	return t.defaultTransport.RoundTrip(req)
+}
+
+func newTLSTransport(profile config.TLSProfile) (*http.Transport, error) {
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: profile.ServerName,
+	}
+
+	if profile.CAFile != "" {
+		rootCAs, err := loadCertPool(profile.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = rootCAs
+	}
+
+	if profile.CertFile != "" {
+		certificate, err := tls.LoadX509KeyPair(profile.CertFile, profile.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	return transport, nil
+}
+
+// loadCertPool adds the CA bundle to the system roots, so public hosts remain reachable.
+func loadCertPool(caFile string) (*x509.CertPool, error) {
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+
+	bundle, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+	if !pool.AppendCertsFromPEM(bundle) {
+		return nil, fmt.Errorf("CA bundle %s contains no certificates", caFile)
+	}
+	return pool, nil
+}
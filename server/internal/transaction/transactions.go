@@ -3,26 +3,70 @@ package transaction
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"github.com/mat-sik/sql-distributed-transactions/server/internal/logging"
+	"go.opentelemetry.io/otel/metric"
+	"slices"
+	"strings"
+	"time"
+
+	commons "github.com/mat-sik/sql-distributed-transactions/common/transaction"
 )
 
 type Repository interface {
 	beginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
 	finishTx(tx *sql.Tx, err error) error
-	enqueueTransaction(ctx context.Context, createTransaction createTransaction) error
-	fetchLockedTransactions(ctx context.Context, tx *sql.Tx, batchSize int) ([]transaction, error)
-	updateLockedTransactionState(ctx context.Context, tx *sql.Tx, id int, state state) error
+	withSavepoint(ctx context.Context, tx *sql.Tx, fn func() error) error
+	enqueueTransaction(ctx context.Context, createTransaction createTransaction) (int, bool, error)
+	enqueueTransactions(ctx context.Context, createTransactions []createTransaction) ([]int, []bool, error)
+	fetchTransaction(ctx context.Context, id int) (transactionStatus, error)
+	fetchFailedTransactions(ctx context.Context, afterID int, limit int) ([]transactionStatus, error)
+	fetchTransactions(ctx context.Context, filter transactionFilter, afterID int, limit int) ([]transactionStatus, error)
+	countTransactions(ctx context.Context, filter transactionFilter) (map[state]int, error)
+	requeueFailedTransaction(ctx context.Context, id int) error
+	cancelTransaction(ctx context.Context, id int) error
+	countReplayableTransactions(ctx context.Context, filter transactionFilter, afterID int) (int, error)
+	replayTransactions(ctx context.Context, filter transactionFilter, mode string, afterID int, limit int) ([]int, int, error)
+	takeRateLimitToken(ctx context.Context, key string, requestsPerSecond float64, burst int) (float64, error)
+	returnRateLimitToken(ctx context.Context, key string) error
+	fetchQueueStats(ctx context.Context) ([]queueStats, error)
+	claimTransactions(ctx context.Context, leasedBy string, leaseDuration time.Duration, agingInterval time.Duration, batchSize int) ([]transaction, error)
+	updateLeasedTransactionState(ctx context.Context, tx *sql.Tx, update transactionUpdate) (bool, error)
+	insertTransactionAttempt(ctx context.Context, tx *sql.Tx, attempt transactionAttempt) error
+	fetchTransactionAttempts(ctx context.Context, transactionID int) ([]transactionAttempt, error)
+	createSaga(ctx context.Context, createSaga createSaga) (int, error)
+	fetchSaga(ctx context.Context, id int) (sagaStatus, error)
+	advanceSaga(ctx context.Context, tx *sql.Tx, transactionID int, outcome state) error
+	createTwoPhaseCommit(ctx context.Context, createCommit createTwoPhaseCommit) (int, error)
+	fetchTwoPhaseCommit(ctx context.Context, id int) (twoPhaseCommitStatus, error)
+	fetchUnresolvedTwoPhaseCommitIDs(ctx context.Context, afterID int, limit int) ([]int, error)
+	reconcileTwoPhaseCommit(ctx context.Context, tx *sql.Tx, id int) error
+	createRecurringTransaction(ctx context.Context, upsert upsertRecurringTransaction) (recurringTransaction, error)
+	replaceRecurringTransaction(ctx context.Context, id int, upsert upsertRecurringTransaction) (recurringTransaction, error)
+	deleteRecurringTransaction(ctx context.Context, id int) error
+	fetchRecurringTransaction(ctx context.Context, id int) (recurringTransaction, error)
+	fetchRecurringTransactions(ctx context.Context, afterID int, limit int) ([]recurringTransaction, error)
+	lockDueRecurringTransactions(ctx context.Context, tx *sql.Tx, limit int) ([]recurringTransaction, error)
+	fireRecurringTransaction(ctx context.Context, tx *sql.Tx, t recurringTransaction, nextFireAt time.Time, carrierJSON string) (int, error)
+	postponeRecurringTransaction(ctx context.Context, tx *sql.Tx, id int, nextFireAt time.Time) error
 }
 
 type SQLRepository struct {
-	pool *sql.DB
+	pool     *sql.DB
+	enqueued *enqueuedTransactions
 }
 
-func NewSQLRepository(pool *sql.DB) *SQLRepository {
-	return &SQLRepository{
-		pool: pool,
+func NewSQLRepository(pool *sql.DB, meter metric.Meter) (*SQLRepository, error) {
+	enqueued, err := newEnqueuedTransactions(meter)
+	if err != nil {
+		return nil, err
 	}
+
+	return &SQLRepository{
+		pool:     pool,
+		enqueued: enqueued,
+	}, nil
 }
 
 func (r SQLRepository) beginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error) {
@@ -38,6 +82,7 @@ func (r SQLRepository) finishTx(tx *sql.Tx, err error) error {
 	} else {
 		txFinalizeErr = tx.Commit()
 	}
+	r.enqueued.finish(tx, err == nil && txFinalizeErr == nil)
 	if err != nil && txFinalizeErr != nil {
 		return fmt.Errorf("%v: %w", txFinalizeErr, err)
 	} else if txFinalizeErr != nil {
@@ -46,23 +91,69 @@ func (r SQLRepository) finishTx(tx *sql.Tx, err error) error {
 	return err
 }
 
-func (r SQLRepository) fetchLockedTransactions(ctx context.Context, tx *sql.Tx, batchSize int) ([]transaction, error) {
+// withSavepoint runs fn within a savepoint of tx. When fn fails, only the changes it has made are rolled back, and tx
+// can still be used.
+func (r SQLRepository) withSavepoint(ctx context.Context, tx *sql.Tx, fn func() error) error {
+	if _, err := tx.ExecContext(ctx, "SAVEPOINT nested"); err != nil {
+		return err
+	}
+	held := r.enqueued.held(tx)
+	if err := fn(); err != nil {
+		if _, rollbackErr := tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT nested"); rollbackErr != nil {
+			return fmt.Errorf("%v: %w", rollbackErr, err)
+		}
+		r.enqueued.dropAfter(tx, held)
+		return err
+	}
+	_, err := tx.ExecContext(ctx, "RELEASE SAVEPOINT nested")
+	return err
+}
+
+// claimTransactions leases up to batchSize due transactions to the given worker by moving them to the IN_FLIGHT state.
+// Transactions whose lease has expired are claimed again, since the worker holding them is presumed dead. The claim
+// commits immediately, so no database locks are held while the remote calls are made. A transaction with an ordering key
+// is only claimed once every earlier transaction with the same key has reached a terminal state.
+func (r SQLRepository) claimTransactions(ctx context.Context, leasedBy string, leaseDuration time.Duration, agingInterval time.Duration, batchSize int) ([]transaction, error) {
+	// The inner ORDER BY only picks which transactions are claimed, while the rows returned by UPDATE come in no
+	// particular order, so the claimed rows are ordered once more.
 	query := `
-		SELECT id, host, path, method, payload, carrier_json
-		FROM transactions
-		WHERE state != 'DONE'
-		ORDER BY id
-		FOR UPDATE SKIP LOCKED
-		LIMIT $1
+		WITH claimed AS (
+			UPDATE transactions
+			SET state = 'IN_FLIGHT',
+			    leased_by = $1,
+			    lease_expires_at = now() + make_interval(secs => $2),
+			    updated_at = now()
+			WHERE id IN (
+				SELECT id
+				FROM transactions t
+				WHERE ((state IN ('PENDING', 'RETRY') AND next_attempt_at <= now())
+				   OR (state = 'IN_FLIGHT' AND lease_expires_at <= now()))
+				  AND (ordering_key IS NULL OR NOT EXISTS (
+					SELECT 1
+					FROM transactions earlier
+					WHERE earlier.ordering_key = t.ordering_key
+					  AND earlier.id < t.id
+					  AND earlier.state IN ('PENDING', 'RETRY', 'IN_FLIGHT')
+				  ))
+				ORDER BY ` + effectivePriority + ` DESC, id
+				FOR UPDATE SKIP LOCKED
+				LIMIT $3
+			)
+			RETURNING id, scheme, host, path, method, payload, carrier_json, idempotency_key, replays, attempts,
+			          max_attempts, response_policy, headers, content_type, saga_id, two_phase_commit_id, expires_at,
+			          lease_expires_at, priority, next_attempt_at, ` + effectivePriority + ` AS effective_priority,
+			          coalesce(created_at::timestamptz, now()) AS created_at
+		)
+		SELECT * FROM claimed ORDER BY effective_priority DESC, id
 	`
 
-	stmt, err := tx.PrepareContext(ctx, query)
+	stmt, err := r.pool.PrepareContext(ctx, query)
 	if err != nil {
 		return nil, err
 	}
 	defer logging.LoggedClose(stmt)
 
-	rows, err := stmt.QueryContext(ctx, batchSize)
+	rows, err := stmt.QueryContext(ctx, leasedBy, leaseDuration.Seconds(), batchSize, agingInterval.Seconds())
 	if err != nil {
 		return nil, err
 	}
@@ -71,7 +162,30 @@ func (r SQLRepository) fetchLockedTransactions(ctx context.Context, tx *sql.Tx,
 	var transactions []transaction
 	for rows.Next() {
 		var t transaction
-		if err = rows.Scan(&t.ID, &t.Host, &t.Path, &t.Method, &t.Payload, &t.CarrierJSON); err != nil {
+		if err = rows.Scan(
+			&t.ID,
+			&t.Scheme,
+			&t.Host,
+			&t.Path,
+			&t.Method,
+			&t.Payload,
+			&t.CarrierJSON,
+			&t.IdempotencyKey,
+			&t.Replays,
+			&t.Attempts,
+			&t.MaxAttempts,
+			&t.ResponsePolicy,
+			&t.Headers,
+			&t.ContentType,
+			&t.SagaID,
+			&t.TwoPhaseCommitID,
+			&t.ExpiresAt,
+			&t.LeaseExpiresAt,
+			&t.Priority,
+			&t.NextAttemptAt,
+			&t.EffectivePriority,
+			&t.CreatedAt,
+		); err != nil {
 			return nil, err
 		}
 		transactions = append(transactions, t)
@@ -84,33 +198,500 @@ func (r SQLRepository) fetchLockedTransactions(ctx context.Context, tx *sql.Tx,
 	return transactions, nil
 }
 
-func (r SQLRepository) updateLockedTransactionState(ctx context.Context, tx *sql.Tx, id int, state state) error {
+// updateLeasedTransactionState writes the outcome of an attempt and releases the lease. It reports false when the
+// worker no longer holds the lease, in which case the transaction is left untouched.
+func (r SQLRepository) updateLeasedTransactionState(ctx context.Context, tx *sql.Tx, update transactionUpdate) (bool, error) {
+	query := `
+		UPDATE transactions
+		SET state = $3,
+		    attempts = CASE WHEN $6 THEN attempts + 1 ELSE attempts END,
+		    last_status_code = CASE WHEN $6 THEN $4 ELSE last_status_code END,
+		    last_attempt_at = CASE WHEN $6 THEN now() ELSE last_attempt_at END,
+		    next_attempt_at = now() + make_interval(secs => $5),
+		    leased_by = NULL,
+		    lease_expires_at = NULL,
+		    updated_at = now()
+		WHERE id = $1 AND state = 'IN_FLIGHT' AND leased_by = $2
+	`
+
+	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		return false, err
+	}
+	defer logging.LoggedClose(stmt)
+
+	lastStatusCode := sql.NullInt32{
+		Int32: int32(update.StatusCode),
+		Valid: update.StatusCode != 0,
+	}
+
+	result, err := stmt.ExecContext(
+		ctx,
+		update.ID,
+		update.LeasedBy,
+		update.State,
+		lastStatusCode,
+		update.RetryDelay.Seconds(),
+		update.Attempted,
+	)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected == 1, nil
+}
+
+type transactionUpdate struct {
+	ID         int
+	LeasedBy   string
+	State      state
+	StatusCode int
+	RetryDelay time.Duration
+	// Attempted is false when the transaction has not been sent, so the attempt counter is left as it is.
+	Attempted bool
+}
+
+type transaction struct {
+	ID               int
+	Scheme           string
+	Host             string
+	Path             string
+	Method           string
+	Payload          sql.NullString
+	CarrierJSON      string
+	IdempotencyKey   sql.NullString
+	Replays          int
+	Attempts         int
+	MaxAttempts      sql.NullInt32
+	ResponsePolicy   sql.NullString
+	Headers          sql.NullString
+	ContentType      sql.NullString
+	SagaID           sql.NullInt64
+	TwoPhaseCommitID sql.NullInt64
+	ExpiresAt        sql.NullTime
+	LeaseExpiresAt   time.Time
+	Priority         int
+	// NextAttemptAt is when the transaction became due, EffectivePriority is its priority raised by the time it has
+	// waited since.
+	NextAttemptAt     time.Time
+	EffectivePriority int
+	CreatedAt         time.Time
+}
+
+// deliveryIdempotencyKey is the idempotency key sent to the remote host. Once the transaction has been replayed in the
+// reset mode, each replay is sent with a key of its own, so the host does not take it for the delivery it has already
+// seen.
+func (t transaction) deliveryIdempotencyKey() string {
+	if t.Replays == 0 {
+		return t.IdempotencyKey.String
+	}
+	return fmt.Sprintf("%s-replay-%d", t.IdempotencyKey.String, t.Replays)
+}
+
+// effectivePriority raises the priority of a due transaction by one for each aging interval, passed as $4, it has
+// waited. It is computed at claim time, so it cannot be indexed.
+const effectivePriority = `(priority + floor(extract(epoch FROM greatest(now() - next_attempt_at, interval '0')) / $4::float8))::int`
+
+// enqueueTransaction inserts a new transaction and returns its ID. When a transaction with the same idempotency key
+// already exists, nothing is inserted and the ID of the existing transaction is returned with created set to false.
+func (r SQLRepository) enqueueTransaction(ctx context.Context, createTransaction createTransaction) (int, bool, error) {
+	id, created, err := enqueueTransaction(ctx, r.pool, createTransaction)
+	if created {
+		r.enqueued.record(ctx, createTransaction.Host)
+	}
+	return id, created, err
+}
+
+func enqueueTransaction(ctx context.Context, db preparer, createTransaction createTransaction) (id int, created bool, err error) {
+	id, err = insertTransaction(ctx, db, createTransaction)
+	if errors.Is(err, sql.ErrNoRows) {
+		id, err = fetchTransactionIDByIdempotencyKey(ctx, db, createTransaction.IdempotencyKey.String)
+		return id, false, err
+	}
+	if err != nil {
+		return 0, false, err
+	}
+
+	return id, true, nil
+}
+
+type preparer interface {
+	PrepareContext(ctx context.Context, query string) (*sql.Stmt, error)
+}
+
+// insertTransaction inserts a new transaction using either the pool or a sql transaction. It returns sql.ErrNoRows
+// when a transaction with the same idempotency key already exists.
+func insertTransaction(ctx context.Context, db preparer, createTransaction createTransaction) (id int, err error) {
+	query := `
+		INSERT INTO transactions (` + insertTransactionColumns + `)
+		VALUES (` + insertTransactionValues(1) + `)
+		ON CONFLICT (idempotency_key) DO NOTHING
+		RETURNING id
+	`
+
+	stmt, err := db.PrepareContext(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+	defer logging.LoggedClose(stmt)
+
+	if err = stmt.QueryRowContext(ctx, createTransaction.insertArgs()...).Scan(&id); err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+// insertHeldTransaction inserts a new transaction within tx, and holds it to be counted once tx commits.
+func (r SQLRepository) insertHeldTransaction(ctx context.Context, tx *sql.Tx, createTransaction createTransaction) (int, error) {
+	id, err := insertTransaction(ctx, tx, createTransaction)
+	if err != nil {
+		return 0, err
+	}
+	r.enqueued.hold(tx, createTransaction.Host)
+	return id, nil
+}
+
+const insertTransactionColumns = `host, path, method, payload, state, carrier_json, idempotency_key, max_attempts,
+		response_policy, headers, content_type, scheme, saga_id, two_phase_commit_id, ordering_key, next_attempt_at,
+		expires_at, priority`
+
+// insertTransactionValuesFormat lists the values of insertTransactionColumns, in the order of insertArgs.
+const insertTransactionValuesFormat = `%[1]s, %[2]s, %[3]s, %[4]s, %[5]s, %[6]s, %[7]s, %[8]s, %[9]s, %[10]s, %[11]s,
+		%[12]s, %[13]s, %[14]s, %[15]s,
+		COALESCE(%[16]s, now()) + make_interval(secs => %[17]s),
+		CASE WHEN %[19]s::float8 > 0 THEN now() + make_interval(secs => %[19]s) ELSE %[18]s END,
+		%[20]s`
+
+const insertTransactionArgCount = 20
+
+// insertTransactionValues returns the values of insertTransactionColumns, with the placeholders numbered from first.
+func insertTransactionValues(first int) string {
+	placeholders := make([]any, insertTransactionArgCount)
+	for i := range placeholders {
+		placeholders[i] = fmt.Sprintf("$%d", first+i)
+	}
+	return fmt.Sprintf(insertTransactionValuesFormat, placeholders...)
+}
+
+func (c createTransaction) insertArgs() []any {
+	return []any{
+		c.Host,
+		c.Path,
+		c.Method,
+		c.Payload,
+		PENDING,
+		c.carrierJSON,
+		c.IdempotencyKey,
+		c.MaxAttempts,
+		c.ResponsePolicy,
+		c.Headers,
+		c.ContentType,
+		c.Scheme,
+		c.SagaID,
+		c.TwoPhaseCommitID,
+		c.OrderingKey,
+		c.NotBefore,
+		c.Delay.Seconds(),
+		c.ExpiresAt,
+		c.TTL.Seconds(),
+		c.Priority,
+	}
+}
+
+// enqueueTransactions inserts the transactions with a single statement, and returns their IDs in the order of
+// createTransactions. Transactions whose idempotency key is already taken are not inserted, the ID of the existing
+// transaction is returned instead, with created set to false.
+func (r SQLRepository) enqueueTransactions(ctx context.Context, createTransactions []createTransaction) (ids []int, created []bool, err error) {
+	tx, err := r.beginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() {
+		err = r.finishTx(tx, err)
+	}()
+
+	// The IDs are allocated upfront, because the order of the rows returned by a multi-row insert is not guaranteed.
+	ids, err = allocateTransactionIDs(ctx, tx, len(createTransactions))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	inserted, err := insertTransactions(ctx, tx, ids, createTransactions)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	created = make([]bool, len(createTransactions))
+	for i, createT := range createTransactions {
+		if inserted[ids[i]] {
+			created[i] = true
+			r.enqueued.hold(tx, createT.Host)
+			continue
+		}
+		if ids[i], err = fetchTransactionIDByIdempotencyKey(ctx, tx, createT.IdempotencyKey.String); err != nil {
+			return nil, nil, err
+		}
+	}
+	return ids, created, nil
+}
+
+func allocateTransactionIDs(ctx context.Context, tx *sql.Tx, count int) ([]int, error) {
 	query := `
-		UPDATE transactions SET state = $2 WHERE id = $1
+		SELECT nextval(pg_get_serial_sequence('transactions', 'id')) FROM generate_series(1, $1)
 	`
 
 	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer logging.LoggedClose(stmt)
+
+	rows, err := stmt.QueryContext(ctx, count)
+	if err != nil {
+		return nil, err
+	}
+	defer logging.LoggedClose(rows)
+
+	ids := make([]int, 0, count)
+	for rows.Next() {
+		var id int
+		if err = rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+func insertTransactions(ctx context.Context, tx *sql.Tx, ids []int, createTransactions []createTransaction) (map[int]bool, error) {
+	values := make([]string, 0, len(createTransactions))
+	args := make([]any, 0, len(createTransactions)*(insertTransactionArgCount+1))
+	for i, createT := range createTransactions {
+		values = append(values, fmt.Sprintf("(%s, $%d)", insertTransactionValues(len(args)+1), len(args)+insertTransactionArgCount+1))
+		args = append(args, createT.insertArgs()...)
+		args = append(args, ids[i])
+	}
+
+	query := `
+		INSERT INTO transactions (` + insertTransactionColumns + `, id)
+		VALUES ` + strings.Join(values, ", ") + `
+		ON CONFLICT (idempotency_key) DO NOTHING
+		RETURNING id
+	`
+
+	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer logging.LoggedClose(stmt)
+
+	rows, err := stmt.QueryContext(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer logging.LoggedClose(rows)
+
+	inserted := make(map[int]bool, len(createTransactions))
+	for rows.Next() {
+		var id int
+		if err = rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		inserted[id] = true
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return inserted, nil
+}
+
+func fetchTransactionIDByIdempotencyKey(ctx context.Context, db preparer, idempotencyKey string) (int, error) {
+	query := `
+		SELECT id FROM transactions WHERE idempotency_key = $1
+	`
+
+	stmt, err := db.PrepareContext(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+	defer logging.LoggedClose(stmt)
+
+	var id int
+	err = stmt.QueryRowContext(ctx, idempotencyKey).Scan(&id)
+	return id, err
+}
+
+func (r SQLRepository) fetchTransaction(ctx context.Context, id int) (transactionStatus, error) {
+	query := `
+		SELECT ` + transactionStatusColumns + `
+		FROM transactions
+		WHERE id = $1
+	`
+
+	stmt, err := r.pool.PrepareContext(ctx, query)
+	if err != nil {
+		return transactionStatus{}, err
+	}
+	defer logging.LoggedClose(stmt)
+
+	return scanTransactionStatus(stmt.QueryRowContext(ctx, id))
+}
+
+func (r SQLRepository) fetchFailedTransactions(ctx context.Context, afterID int, limit int) ([]transactionStatus, error) {
+	query := `
+		SELECT ` + transactionStatusColumns + `
+		FROM transactions
+		WHERE state = 'FAILED' AND id > $1
+		ORDER BY id
+		LIMIT $2
+	`
+
+	stmt, err := r.pool.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer logging.LoggedClose(stmt)
+
+	rows, err := stmt.QueryContext(ctx, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer logging.LoggedClose(rows)
+
+	var transactions []transactionStatus
+	for rows.Next() {
+		t, err := scanTransactionStatus(rows)
+		if err != nil {
+			return nil, err
+		}
+		transactions = append(transactions, t)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return transactions, nil
+}
+
+// requeueFailedTransaction moves a dead-lettered transaction back to the PENDING state with a fresh attempt counter.
+// It returns sql.ErrNoRows when the transaction does not exist and errInvalidState when it is not dead-lettered. The
+// forward steps of sagas and the prepare calls of two-phase commits cannot be requeued, since their failure has already
+// been acted upon.
+func (r SQLRepository) requeueFailedTransaction(ctx context.Context, id int) error {
+	query := `
+		UPDATE transactions
+		SET state = 'PENDING',
+		    attempts = 0,
+		    next_attempt_at = now(),
+		    updated_at = now()
+		WHERE id = $1
+		  AND state = 'FAILED'
+		  AND NOT EXISTS (SELECT 1 FROM saga_steps WHERE forward_transaction_id = $1)
+		  AND NOT EXISTS (SELECT 1 FROM two_phase_commit_participants WHERE prepare_transaction_id = $1)
+		RETURNING id
+	`
+
+	stmt, err := r.pool.PrepareContext(ctx, query)
 	if err != nil {
 		return err
 	}
 	defer logging.LoggedClose(stmt)
 
-	_, err = stmt.ExecContext(ctx, id, state)
+	var requeuedID int
+	err = stmt.QueryRowContext(ctx, id).Scan(&requeuedID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return r.stateMismatchErr(ctx, id)
+	}
 	return err
 }
 
-type transaction struct {
-	ID          int
-	Host        string
-	Path        string
-	Method      string
-	Payload     sql.NullString
-	CarrierJSON string
+// cancelTransaction moves a transaction which is waiting for its next attempt to the CANCELLED state. A transaction
+// being claimed concurrently is locked by the claim, so the cancellation waits for it and then finds it IN_FLIGHT.
+// The saga or the two-phase commit of the transaction is advanced as if the transaction has failed.
+func (r SQLRepository) cancelTransaction(ctx context.Context, id int) (err error) {
+	tx, err := r.beginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err = r.finishTx(tx, err)
+	}()
+
+	query := `
+		UPDATE transactions
+		SET state = 'CANCELLED',
+		    updated_at = now()
+		WHERE id = $1
+		  AND state IN ('PENDING', 'RETRY')
+		RETURNING saga_id, two_phase_commit_id
+	`
+
+	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer logging.LoggedClose(stmt)
+
+	var sagaID, twoPhaseCommitID sql.NullInt64
+	err = stmt.QueryRowContext(ctx, id).Scan(&sagaID, &twoPhaseCommitID)
+	if errors.Is(err, sql.ErrNoRows) {
+		s, err := fetchTransactionState(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		return fmt.Errorf("%w: transaction is in the %s state", errInvalidState, s)
+	}
+	if err != nil {
+		return err
+	}
+
+	if sagaID.Valid {
+		if err = r.advanceSaga(ctx, tx, id, CANCELLED); err != nil {
+			return err
+		}
+	}
+	if twoPhaseCommitID.Valid {
+		if err = r.reconcileTwoPhaseCommit(ctx, tx, int(twoPhaseCommitID.Int64)); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func (r SQLRepository) enqueueTransaction(ctx context.Context, createTransaction createTransaction) error {
+func fetchTransactionState(ctx context.Context, db preparer, id int) (state, error) {
 	query := `
-		INSERT INTO transactions (host, path, method, payload, state, carrier_json) VALUES ($1, $2, $3, $4, $5, $6)
+		SELECT state FROM transactions WHERE id = $1
+	`
+
+	stmt, err := db.PrepareContext(ctx, query)
+	if err != nil {
+		return "", err
+	}
+	defer logging.LoggedClose(stmt)
+
+	var s state
+	err = stmt.QueryRowContext(ctx, id).Scan(&s)
+	return s, err
+}
+
+// stateMismatchErr explains why a conditional state update did not match the transaction with the given id.
+func (r SQLRepository) stateMismatchErr(ctx context.Context, id int) error {
+	query := `
+		SELECT state,
+		       EXISTS (SELECT 1 FROM saga_steps WHERE forward_transaction_id = $1),
+		       EXISTS (SELECT 1 FROM two_phase_commit_participants WHERE prepare_transaction_id = $1)
+		FROM transactions
+		WHERE id = $1
 	`
 
 	stmt, err := r.pool.PrepareContext(ctx, query)
@@ -119,49 +700,151 @@ func (r SQLRepository) enqueueTransaction(ctx context.Context, createTransaction
 	}
 	defer logging.LoggedClose(stmt)
 
-	_, err = stmt.ExecContext(
-		ctx,
-		createTransaction.Host,
-		createTransaction.Path,
-		createTransaction.Method,
-		createTransaction.Payload,
-		PENDING,
-		createTransaction.carrierJSON,
+	var s state
+	var sagaForwardStep, prepareCall bool
+	if err = stmt.QueryRowContext(ctx, id).Scan(&s, &sagaForwardStep, &prepareCall); err != nil {
+		return err
+	}
+	if sagaForwardStep && s == FAILED {
+		return fmt.Errorf("%w: transaction is a forward step of a saga", errInvalidState)
+	}
+	if prepareCall && s == FAILED {
+		return fmt.Errorf("%w: transaction is a prepare call of a two-phase commit", errInvalidState)
+	}
+	return fmt.Errorf("%w: transaction is in the %s state", errInvalidState, s)
+}
+
+const transactionStatusColumns = `id, scheme, host, path, method, idempotency_key, ordering_key, priority, state,
+		attempts, max_attempts, last_status_code, created_at, updated_at, next_attempt_at, last_attempt_at,
+		expires_at`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanTransactionStatus(row rowScanner) (transactionStatus, error) {
+	var t transactionStatus
+	err := row.Scan(
+		&t.ID,
+		&t.Scheme,
+		&t.Host,
+		&t.Path,
+		&t.Method,
+		&t.IdempotencyKey,
+		&t.OrderingKey,
+		&t.Priority,
+		&t.State,
+		&t.Attempts,
+		&t.MaxAttempts,
+		&t.LastStatusCode,
+		&t.CreatedAt,
+		&t.UpdatedAt,
+		&t.NextAttemptAt,
+		&t.LastAttemptAt,
+		&t.ExpiresAt,
 	)
+	if err != nil {
+		return transactionStatus{}, err
+	}
+	return t, nil
+}
 
-	return err
+type transactionStatus struct {
+	ID             int
+	Scheme         string
+	Host           string
+	Path           string
+	Method         string
+	IdempotencyKey sql.NullString
+	OrderingKey    sql.NullString
+	Priority       int
+	State          state
+	Attempts       int
+	MaxAttempts    sql.NullInt32
+	LastStatusCode sql.NullInt32
+	CreatedAt      sql.NullTime
+	UpdatedAt      time.Time
+	NextAttemptAt  time.Time
+	LastAttemptAt  sql.NullTime
+	ExpiresAt      sql.NullTime
+}
+
+func (t transactionStatus) toResponse() commons.Transaction {
+	resp := commons.Transaction{
+		ID:             t.ID,
+		Scheme:         t.Scheme,
+		Host:           t.Host,
+		Path:           t.Path,
+		Method:         t.Method,
+		IdempotencyKey: t.IdempotencyKey.String,
+		OrderingKey:    t.OrderingKey.String,
+		Priority:       t.Priority,
+		State:          string(t.State),
+		Attempts:       t.Attempts,
+		CreatedAt:      t.CreatedAt.Time,
+		UpdatedAt:      t.UpdatedAt,
+		NextAttemptAt:  t.NextAttemptAt,
+	}
+	if t.MaxAttempts.Valid {
+		maxAttempts := int(t.MaxAttempts.Int32)
+		resp.MaxAttempts = &maxAttempts
+	}
+	if t.LastStatusCode.Valid {
+		statusCode := int(t.LastStatusCode.Int32)
+		resp.LastStatusCode = &statusCode
+	}
+	if t.LastAttemptAt.Valid {
+		resp.LastAttemptAt = &t.LastAttemptAt.Time
+	}
+	if t.ExpiresAt.Valid {
+		resp.ExpiresAt = &t.ExpiresAt.Time
+	}
+	return resp
 }
 
 type createTransaction struct {
-	Host        string
-	Path        string
-	Method      string
-	Payload     sql.NullString
-	carrierJSON string
+	Scheme           string
+	Host             string
+	Path             string
+	Method           string
+	Payload          sql.NullString
+	IdempotencyKey   sql.NullString
+	MaxAttempts      sql.NullInt32
+	ResponsePolicy   sql.NullString
+	Headers          sql.NullString
+	ContentType      sql.NullString
+	SagaID           sql.NullInt64
+	TwoPhaseCommitID sql.NullInt64
+	OrderingKey      sql.NullString
+	Priority         int
+	NotBefore        sql.NullTime
+	Delay            time.Duration
+	ExpiresAt        sql.NullTime
+	TTL              time.Duration
+	carrierJSON      string
 }
 
 type state string
 
 const (
-	DONE    state = "DONE"
-	PENDING state = "PENDING"
-	RETRY   state = "RETRY"
+	DONE      state = "DONE"
+	PENDING   state = "PENDING"
+	RETRY     state = "RETRY"
+	FAILED    state = "FAILED"
+	IN_FLIGHT state = "IN_FLIGHT"
+	EXPIRED   state = "EXPIRED"
+	CANCELLED state = "CANCELLED"
 )
 
-func CreateTransactionsTableIfNotExist(ctx context.Context, pool *sql.DB) error {
-	query := `
-		CREATE TABLE IF NOT EXISTS transactions (
-    	id BIGSERIAL NOT NULL,
-    	host TEXT NOT NULL,
-    	path TEXT NOT NULL,
-    	method TEXT NOT NULL,
-    	payload TEXT NULL,
-    	state TEXT NOT NULL,
-    	created_at TIMESTAMP DEFAULT now(),
-		carrier_json TEXT NOT NULL,
-    	PRIMARY KEY (id)
-		)
-	`
-	_, err := pool.ExecContext(ctx, query)
-	return err
+var states = []state{DONE, PENDING, RETRY, FAILED, IN_FLIGHT, EXPIRED, CANCELLED}
+
+func (s state) isKnown() bool {
+	return slices.Contains(states, s)
+}
+
+// isTerminal reports whether the transaction is never going to be sent again without an operator requeueing it.
+func (s state) isTerminal() bool {
+	return s == DONE || s == FAILED || s == EXPIRED || s == CANCELLED
 }
+
+var errInvalidState = errors.New("invalid transaction state")
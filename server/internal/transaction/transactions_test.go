@@ -0,0 +1,87 @@
+package transaction
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestInsertTransactionValues(t *testing.T) {
+	tests := []struct {
+		name  string
+		first int
+	}{
+		{name: "single row", first: 1},
+		{name: "second row of a batch", first: insertTransactionArgCount + 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values := insertTransactionValues(tt.first)
+
+			last := tt.first + insertTransactionArgCount - 1
+			for i := tt.first; i <= last; i++ {
+				if !strings.Contains(values, fmt.Sprintf("$%d", i)) {
+					t.Errorf("insertTransactionValues(%d) = %s, want it to contain $%d", tt.first, values, i)
+				}
+			}
+			if next := fmt.Sprintf("$%d", last+1); strings.Contains(values, next) {
+				t.Errorf("insertTransactionValues(%d) = %s, want it without %s", tt.first, values, next)
+			}
+			if strings.Contains(values, "%!") {
+				t.Errorf("insertTransactionValues(%d) = %s, want every placeholder formatted", tt.first, values)
+			}
+		})
+	}
+}
+
+func TestInsertArgsMatchColumns(t *testing.T) {
+	if got := len(createTransaction{}.insertArgs()); got != insertTransactionArgCount {
+		t.Errorf("len(insertArgs()) = %d, want %d", got, insertTransactionArgCount)
+	}
+}
+
+func TestStateIsTerminal(t *testing.T) {
+	tests := []struct {
+		state state
+		want  bool
+	}{
+		{state: PENDING, want: false},
+		{state: IN_FLIGHT, want: false},
+		{state: RETRY, want: false},
+		{state: DONE, want: true},
+		{state: FAILED, want: true},
+		{state: EXPIRED, want: true},
+		{state: CANCELLED, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.state), func(t *testing.T) {
+			if got := tt.state.isTerminal(); got != tt.want {
+				t.Errorf("isTerminal() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDeliveryIdempotencyKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		replays int
+		want    string
+	}{
+		{name: "first delivery", replays: 0, want: "order-42"},
+		{name: "first replay", replays: 1, want: "order-42-replay-1"},
+		{name: "later replay", replays: 3, want: "order-42-replay-3"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr := transaction{IdempotencyKey: sql.NullString{String: "order-42", Valid: true}, Replays: tt.replays}
+			if got := tr.deliveryIdempotencyKey(); got != tt.want {
+				t.Errorf("deliveryIdempotencyKey() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
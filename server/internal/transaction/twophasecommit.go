@@ -0,0 +1,638 @@
+package transaction
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/mat-sik/sql-distributed-transactions/server/internal/config"
+	"github.com/mat-sik/sql-distributed-transactions/server/internal/logging"
+	"github.com/mat-sik/sql-distributed-transactions/server/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"log/slog"
+	"time"
+
+	commons "github.com/mat-sik/sql-distributed-transactions/common/transaction"
+)
+
+// The prepare, commit and abort calls of a two-phase commit are sent as regular transactions. The decision is written
+// to the two_phase_commits row in the same sql transaction which enqueues the commit or abort calls, so the calls can
+// never be sent before the decision is durable. The state of the participants is derived from their transactions.
+
+type twoPhaseCommitState string
+
+const (
+	twoPhaseCommitPreparing  twoPhaseCommitState = "PREPARING"
+	twoPhaseCommitCommitting twoPhaseCommitState = "COMMITTING"
+	twoPhaseCommitAborting   twoPhaseCommitState = "ABORTING"
+	twoPhaseCommitCommitted  twoPhaseCommitState = "COMMITTED"
+	twoPhaseCommitAborted    twoPhaseCommitState = "ABORTED"
+	// twoPhaseCommitFailed means that a commit or abort call has failed, which leaves the participant for an operator
+	// to resolve.
+	twoPhaseCommitFailed twoPhaseCommitState = "FAILED"
+)
+
+type twoPhaseCommitDecision string
+
+const (
+	decisionCommit twoPhaseCommitDecision = "COMMIT"
+	decisionAbort  twoPhaseCommitDecision = "ABORT"
+)
+
+type createTwoPhaseCommit struct {
+	Participants []createTwoPhaseCommitParticipant
+	carrierJSON  string
+}
+
+// createTwoPhaseCommitParticipant holds the calls of a participant as JSON encoded commons.EnqueueTransactionRequest.
+type createTwoPhaseCommitParticipant struct {
+	PrepareRequest string
+	CommitRequest  string
+	AbortRequest   string
+}
+
+func newCreateTwoPhaseCommit(req commons.EnqueueTwoPhaseCommitRequest, carrierJSON string) (createTwoPhaseCommit, error) {
+	commit := createTwoPhaseCommit{
+		Participants: make([]createTwoPhaseCommitParticipant, 0, len(req.Participants)),
+		carrierJSON:  carrierJSON,
+	}
+	for _, participant := range req.Participants {
+		prepare, err := json.Marshal(participant.Prepare)
+		if err != nil {
+			return createTwoPhaseCommit{}, err
+		}
+		commitCall, err := json.Marshal(participant.Commit)
+		if err != nil {
+			return createTwoPhaseCommit{}, err
+		}
+		abort, err := json.Marshal(participant.Abort)
+		if err != nil {
+			return createTwoPhaseCommit{}, err
+		}
+
+		commit.Participants = append(commit.Participants, createTwoPhaseCommitParticipant{
+			PrepareRequest: string(prepare),
+			CommitRequest:  string(commitCall),
+			AbortRequest:   string(abort),
+		})
+	}
+	return commit, nil
+}
+
+// createTwoPhaseCommit inserts the two-phase commit with its participants and enqueues all the prepare calls.
+func (r SQLRepository) createTwoPhaseCommit(ctx context.Context, createCommit createTwoPhaseCommit) (id int, err error) {
+	tx, err := r.beginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		err = r.finishTx(tx, err)
+	}()
+
+	query := `
+		INSERT INTO two_phase_commits (state, carrier_json) VALUES ($1, $2) RETURNING id
+	`
+
+	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+	defer logging.LoggedClose(stmt)
+
+	if err = stmt.QueryRowContext(ctx, twoPhaseCommitPreparing, createCommit.carrierJSON).Scan(&id); err != nil {
+		return 0, err
+	}
+
+	participantQuery := `
+		INSERT INTO two_phase_commit_participants (
+			two_phase_commit_id, position, prepare_request, commit_request, abort_request, prepare_transaction_id
+		) VALUES ($1, $2, $3, $4, $5, $6)
+	`
+
+	participantStmt, err := tx.PrepareContext(ctx, participantQuery)
+	if err != nil {
+		return 0, err
+	}
+	defer logging.LoggedClose(participantStmt)
+
+	for position, participant := range createCommit.Participants {
+		prepareID, err := r.insertTwoPhaseCommitTransaction(ctx, tx, id, position, "prepare", participant.PrepareRequest, createCommit.carrierJSON)
+		if err != nil {
+			return 0, err
+		}
+
+		if _, err = participantStmt.ExecContext(
+			ctx,
+			id,
+			position,
+			participant.PrepareRequest,
+			participant.CommitRequest,
+			participant.AbortRequest,
+			prepareID,
+		); err != nil {
+			return 0, err
+		}
+	}
+
+	return id, nil
+}
+
+// reconcileTwoPhaseCommit brings the two-phase commit in line with the state of its transactions. Once every prepare
+// call has succeeded it decides to commit, and as soon as any of them has failed it decides to abort. After the
+// decision, it enqueues the missing commit or abort calls, and finishes the two-phase commit once they are all done.
+// It is run whenever one of the transactions reaches a terminal state, and by the coordinator to recover from crashes.
+func (r SQLRepository) reconcileTwoPhaseCommit(ctx context.Context, tx *sql.Tx, id int) error {
+	query := `
+		SELECT state, decision, carrier_json FROM two_phase_commits WHERE id = $1 FOR UPDATE
+	`
+
+	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer logging.LoggedClose(stmt)
+
+	var s twoPhaseCommitState
+	var decision sql.NullString
+	var carrierJSON string
+	if err = stmt.QueryRowContext(ctx, id).Scan(&s, &decision, &carrierJSON); err != nil {
+		return err
+	}
+	if s == twoPhaseCommitCommitted || s == twoPhaseCommitAborted {
+		return nil
+	}
+
+	participants, err := fetchParticipantProgress(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+
+	d := twoPhaseCommitDecision(decision.String)
+	if !decision.Valid {
+		var decided bool
+		if d, decided = decide(participants); !decided {
+			return nil
+		}
+		if err = recordDecision(ctx, tx, id, d); err != nil {
+			return err
+		}
+	}
+
+	for i, p := range participants {
+		if p.phaseTwoState(d).Valid {
+			continue
+		}
+		// A participant which is still preparing is aborted once its prepare call finishes.
+		if d == decisionAbort && !p.PrepareState.isTerminal() {
+			continue
+		}
+		if participants[i], err = r.dispatchPhaseTwo(ctx, tx, id, p, d, carrierJSON); err != nil {
+			return err
+		}
+	}
+
+	next := finalState(participants, d)
+	if next == s {
+		return nil
+	}
+	return updateTwoPhaseCommitState(ctx, tx, id, next)
+}
+
+type participantProgress struct {
+	Position          int
+	CommitRequest     string
+	AbortRequest      string
+	PrepareState      state
+	PrepareStatusCode sql.NullInt32
+	CommitState       sql.NullString
+	AbortState        sql.NullString
+}
+
+// prepared reports whether the participant has voted yes. Only a 2xx response to the prepare call is a yes vote,
+// whatever the response policy of the call makes of the others.
+func (p participantProgress) prepared() bool {
+	return p.PrepareState == DONE && p.PrepareStatusCode.Valid &&
+		p.PrepareStatusCode.Int32 >= 200 && p.PrepareStatusCode.Int32 < 300
+}
+
+func (p participantProgress) phaseTwoState(decision twoPhaseCommitDecision) sql.NullString {
+	if decision == decisionCommit {
+		return p.CommitState
+	}
+	return p.AbortState
+}
+
+func fetchParticipantProgress(ctx context.Context, tx *sql.Tx, id int) ([]participantProgress, error) {
+	query := `
+		SELECT p.position, p.commit_request, p.abort_request, prepare_t.state, prepare_t.last_status_code,
+		       commit_t.state, abort_t.state
+		FROM two_phase_commit_participants p
+		JOIN transactions prepare_t ON prepare_t.id = p.prepare_transaction_id
+		LEFT JOIN transactions commit_t ON commit_t.id = p.commit_transaction_id
+		LEFT JOIN transactions abort_t ON abort_t.id = p.abort_transaction_id
+		WHERE p.two_phase_commit_id = $1
+		ORDER BY p.position
+	`
+
+	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer logging.LoggedClose(stmt)
+
+	rows, err := stmt.QueryContext(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	defer logging.LoggedClose(rows)
+
+	var participants []participantProgress
+	for rows.Next() {
+		var p participantProgress
+		if err = rows.Scan(
+			&p.Position,
+			&p.CommitRequest,
+			&p.AbortRequest,
+			&p.PrepareState,
+			&p.PrepareStatusCode,
+			&p.CommitState,
+			&p.AbortState,
+		); err != nil {
+			return nil, err
+		}
+		participants = append(participants, p)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return participants, nil
+}
+
+func decide(participants []participantProgress) (twoPhaseCommitDecision, bool) {
+	prepared := 0
+	for _, p := range participants {
+		if p.prepared() {
+			prepared++
+		} else if p.PrepareState.isTerminal() {
+			return decisionAbort, true
+		}
+	}
+	if prepared == len(participants) {
+		return decisionCommit, true
+	}
+	return "", false
+}
+
+func recordDecision(ctx context.Context, tx *sql.Tx, id int, decision twoPhaseCommitDecision) error {
+	query := `
+		UPDATE two_phase_commits SET decision = $2, decided_at = now(), updated_at = now() WHERE id = $1
+	`
+
+	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer logging.LoggedClose(stmt)
+
+	_, err = stmt.ExecContext(ctx, id, decision)
+	return err
+}
+
+// dispatchPhaseTwo enqueues the commit or abort call of the participant and returns its updated progress.
+func (r SQLRepository) dispatchPhaseTwo(
+	ctx context.Context,
+	tx *sql.Tx,
+	id int,
+	p participantProgress,
+	decision twoPhaseCommitDecision,
+	carrierJSON string,
+) (participantProgress, error) {
+	call, requestJSON, column := "commit", p.CommitRequest, "commit_transaction_id"
+	if decision == decisionAbort {
+		call, requestJSON, column = "abort", p.AbortRequest, "abort_transaction_id"
+	}
+
+	transactionID, err := r.insertTwoPhaseCommitTransaction(ctx, tx, id, p.Position, call, requestJSON, carrierJSON)
+	if err != nil {
+		return participantProgress{}, err
+	}
+
+	query := `
+		UPDATE two_phase_commit_participants SET ` + column + ` = $3 WHERE two_phase_commit_id = $1 AND position = $2
+	`
+
+	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		return participantProgress{}, err
+	}
+	defer logging.LoggedClose(stmt)
+
+	if _, err = stmt.ExecContext(ctx, id, p.Position, transactionID); err != nil {
+		return participantProgress{}, err
+	}
+
+	enqueued := sql.NullString{
+		String: string(PENDING),
+		Valid:  true,
+	}
+	if decision == decisionCommit {
+		p.CommitState = enqueued
+	} else {
+		p.AbortState = enqueued
+	}
+	return p, nil
+}
+
+// finalState returns COMMITTED or ABORTED once every participant has received the decision, and FAILED when some of
+// them could not receive it.
+func finalState(participants []participantProgress, decision twoPhaseCommitDecision) twoPhaseCommitState {
+	pending, failed := false, false
+	for _, p := range participants {
+		phaseTwo := p.phaseTwoState(decision)
+		switch {
+		case !phaseTwo.Valid || !state(phaseTwo.String).isTerminal():
+			pending = true
+		case state(phaseTwo.String) != DONE:
+			failed = true
+		}
+	}
+
+	switch {
+	case pending && decision == decisionCommit:
+		return twoPhaseCommitCommitting
+	case pending:
+		return twoPhaseCommitAborting
+	case failed:
+		return twoPhaseCommitFailed
+	case decision == decisionCommit:
+		return twoPhaseCommitCommitted
+	default:
+		return twoPhaseCommitAborted
+	}
+}
+
+func (r SQLRepository) insertTwoPhaseCommitTransaction(
+	ctx context.Context,
+	tx *sql.Tx,
+	id int,
+	position int,
+	call string,
+	requestJSON string,
+	carrierJSON string,
+) (int, error) {
+	idempotencyKey := fmt.Sprintf("%s%d-%d-%s", commons.TwoPhaseCommitIdempotencyKeyPrefix, id, position, call)
+	createT, err := newCoordinatedTransaction(requestJSON, idempotencyKey, carrierJSON)
+	if err != nil {
+		return 0, err
+	}
+	createT.TwoPhaseCommitID = sql.NullInt64{
+		Int64: int64(id),
+		Valid: true,
+	}
+	return r.insertHeldTransaction(ctx, tx, createT)
+}
+
+func updateTwoPhaseCommitState(ctx context.Context, tx *sql.Tx, id int, s twoPhaseCommitState) error {
+	query := `
+		UPDATE two_phase_commits SET state = $2, updated_at = now() WHERE id = $1
+	`
+
+	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer logging.LoggedClose(stmt)
+
+	_, err = stmt.ExecContext(ctx, id, s)
+	return err
+}
+
+// fetchUnresolvedTwoPhaseCommitIDs returns the two-phase commits which have not received all the commit or abort
+// calls yet.
+func (r SQLRepository) fetchUnresolvedTwoPhaseCommitIDs(ctx context.Context, afterID int, limit int) ([]int, error) {
+	query := `
+		SELECT id
+		FROM two_phase_commits
+		WHERE state IN ('PREPARING', 'COMMITTING', 'ABORTING') AND id > $1
+		ORDER BY id
+		LIMIT $2
+	`
+
+	stmt, err := r.pool.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer logging.LoggedClose(stmt)
+
+	rows, err := stmt.QueryContext(ctx, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer logging.LoggedClose(rows)
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err = rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
+
+func (r SQLRepository) fetchTwoPhaseCommit(ctx context.Context, id int) (twoPhaseCommitStatus, error) {
+	query := `
+		SELECT id, state, decision, decided_at, created_at, updated_at FROM two_phase_commits WHERE id = $1
+	`
+
+	stmt, err := r.pool.PrepareContext(ctx, query)
+	if err != nil {
+		return twoPhaseCommitStatus{}, err
+	}
+	defer logging.LoggedClose(stmt)
+
+	var commit twoPhaseCommitStatus
+	if err = stmt.QueryRowContext(ctx, id).Scan(
+		&commit.ID,
+		&commit.State,
+		&commit.Decision,
+		&commit.DecidedAt,
+		&commit.CreatedAt,
+		&commit.UpdatedAt,
+	); err != nil {
+		return twoPhaseCommitStatus{}, err
+	}
+
+	participantsQuery := `
+		SELECT position, prepare_transaction_id, commit_transaction_id, abort_transaction_id
+		FROM two_phase_commit_participants
+		WHERE two_phase_commit_id = $1
+		ORDER BY position
+	`
+
+	participantsStmt, err := r.pool.PrepareContext(ctx, participantsQuery)
+	if err != nil {
+		return twoPhaseCommitStatus{}, err
+	}
+	defer logging.LoggedClose(participantsStmt)
+
+	rows, err := participantsStmt.QueryContext(ctx, id)
+	if err != nil {
+		return twoPhaseCommitStatus{}, err
+	}
+	defer logging.LoggedClose(rows)
+
+	for rows.Next() {
+		var p twoPhaseCommitParticipantStatus
+		if err = rows.Scan(
+			&p.Position,
+			&p.PrepareTransactionID,
+			&p.CommitTransactionID,
+			&p.AbortTransactionID,
+		); err != nil {
+			return twoPhaseCommitStatus{}, err
+		}
+		commit.Participants = append(commit.Participants, p)
+	}
+
+	if err = rows.Err(); err != nil {
+		return twoPhaseCommitStatus{}, err
+	}
+
+	return commit, nil
+}
+
+type twoPhaseCommitStatus struct {
+	ID           int
+	State        twoPhaseCommitState
+	Decision     sql.NullString
+	DecidedAt    sql.NullTime
+	Participants []twoPhaseCommitParticipantStatus
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+type twoPhaseCommitParticipantStatus struct {
+	Position             int
+	PrepareTransactionID int
+	CommitTransactionID  sql.NullInt64
+	AbortTransactionID   sql.NullInt64
+}
+
+func (c twoPhaseCommitStatus) toResponse() commons.TwoPhaseCommit {
+	resp := commons.TwoPhaseCommit{
+		ID:           c.ID,
+		State:        string(c.State),
+		Decision:     c.Decision.String,
+		Participants: make([]commons.TwoPhaseCommitParticipant, 0, len(c.Participants)),
+		CreatedAt:    c.CreatedAt,
+		UpdatedAt:    c.UpdatedAt,
+	}
+	if c.DecidedAt.Valid {
+		resp.DecidedAt = &c.DecidedAt.Time
+	}
+	for _, p := range c.Participants {
+		participantResp := commons.TwoPhaseCommitParticipant{
+			Position:             p.Position,
+			PrepareTransactionID: p.PrepareTransactionID,
+		}
+		if p.CommitTransactionID.Valid {
+			commitID := int(p.CommitTransactionID.Int64)
+			participantResp.CommitTransactionID = &commitID
+		}
+		if p.AbortTransactionID.Valid {
+			abortID := int(p.AbortTransactionID.Int64)
+			participantResp.AbortTransactionID = &abortID
+		}
+		resp.Participants = append(resp.Participants, participantResp)
+	}
+	return resp
+}
+
+// coordinator periodically reconciles the unresolved two-phase commits. The executor reconciles them as soon as their
+// transactions finish, so this only matters when that has not happened, e.g. after a crash.
+type coordinator struct {
+	tracer     trace.Tracer
+	repository Repository
+	config     config.Executor
+}
+
+func (c coordinator) start(ctx context.Context) {
+	ticker := time.NewTicker(c.config.CoordinatorRecoveryInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := c.recoverTwoPhaseCommits(ctx); err != nil {
+			slog.Error("encountered error while trying to recover the two-phase commits", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c coordinator) recoverTwoPhaseCommits(ctx context.Context) error {
+	ctx, span := c.tracer.Start(ctx, "recoverTwoPhaseCommits")
+	defer span.End()
+
+	afterID := 0
+	for {
+		span.AddEvent("Trying to fetch the unresolved two-phase commits", trace.WithAttributes(
+			attribute.Int("after id", afterID),
+		))
+		ids, err := c.repository.fetchUnresolvedTwoPhaseCommitIDs(ctx, afterID, recoveryBatchSize)
+		if err != nil {
+			tracing.RecordErr(span, err, "Failed to fetch the unresolved two-phase commits", nil)
+			return err
+		}
+
+		for _, id := range ids {
+			if err = c.reconcile(ctx, id); err != nil {
+				tracing.RecordErr(span, err, "Failed to reconcile the two-phase commit", nil)
+				return err
+			}
+		}
+
+		if len(ids) < recoveryBatchSize {
+			return nil
+		}
+		afterID = ids[len(ids)-1]
+	}
+}
+
+func (c coordinator) reconcile(ctx context.Context, id int) (err error) {
+	ctx, span := c.tracer.Start(ctx, "reconcileTwoPhaseCommit")
+	defer span.End()
+
+	span.AddEvent("Trying to begin a sql transaction", trace.WithAttributes(
+		attribute.Int("two-phase commit id", id),
+	))
+	tx, err := c.repository.beginTx(ctx, nil)
+	if err != nil {
+		tracing.RecordErr(span, err, "Failed to begin a sql transaction", nil)
+		return err
+	}
+	defer func() {
+		span.AddEvent("Trying to finalize the sql transaction")
+		err = c.repository.finishTx(tx, err)
+		if err != nil {
+			tracing.RecordErr(span, err, "Failed to finalize the sql transaction", nil)
+		}
+	}()
+
+	return c.repository.reconcileTwoPhaseCommit(ctx, tx, id)
+}
+
+const recoveryBatchSize = 100
@@ -0,0 +1,76 @@
+package transaction
+
+import (
+	"database/sql"
+	"testing"
+)
+
+func TestDecide(t *testing.T) {
+	prepared := func(statusCode int32) participantProgress {
+		return participantProgress{
+			PrepareState:      DONE,
+			PrepareStatusCode: sql.NullInt32{Int32: statusCode, Valid: true},
+		}
+	}
+	inState := func(s state) participantProgress {
+		return participantProgress{PrepareState: s}
+	}
+
+	tests := []struct {
+		name         string
+		participants []participantProgress
+		decision     twoPhaseCommitDecision
+		decided      bool
+	}{
+		{
+			name:         "every participant prepared",
+			participants: []participantProgress{prepared(200), prepared(204)},
+			decision:     decisionCommit,
+			decided:      true,
+		},
+		{
+			name:         "some participants still preparing",
+			participants: []participantProgress{prepared(200), inState(IN_FLIGHT), inState(RETRY)},
+			decided:      false,
+		},
+		{
+			name:         "a participant refused with a 4xx classified as done",
+			participants: []participantProgress{prepared(200), prepared(409)},
+			decision:     decisionAbort,
+			decided:      true,
+		},
+		{
+			name:         "a participant answered with a 3xx classified as done",
+			participants: []participantProgress{prepared(302), inState(PENDING)},
+			decision:     decisionAbort,
+			decided:      true,
+		},
+		{
+			name:         "a participant is done without a status code",
+			participants: []participantProgress{inState(DONE)},
+			decision:     decisionAbort,
+			decided:      true,
+		},
+		{
+			name:         "a participant failed",
+			participants: []participantProgress{inState(FAILED), inState(PENDING)},
+			decision:     decisionAbort,
+			decided:      true,
+		},
+		{
+			name:         "a participant expired",
+			participants: []participantProgress{prepared(200), inState(EXPIRED)},
+			decision:     decisionAbort,
+			decided:      true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decision, decided := decide(tt.participants)
+			if decision != tt.decision || decided != tt.decided {
+				t.Errorf("decide() = (%q, %v), want (%q, %v)", decision, decided, tt.decision, tt.decided)
+			}
+		})
+	}
+}
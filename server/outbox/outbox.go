@@ -0,0 +1,28 @@
+// Package outbox enqueues transactions directly in the database of the server, within the sql transaction of the
+// caller. The transaction is only sent by the server's executor once the caller commits, so the outgoing call is
+// committed atomically with the caller's own rows. The caller's database must be the one the server runs against.
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/mat-sik/sql-distributed-transactions/server/internal/transaction"
+
+	commons "github.com/mat-sik/sql-distributed-transactions/common/transaction"
+)
+
+// Enqueue writes the transaction to the transactions table within tx. When a transaction with the same idempotency
+// key already exists, nothing is written and the ID of the existing transaction is returned.
+func Enqueue(ctx context.Context, tx *sql.Tx, request commons.EnqueueTransactionRequest) (commons.EnqueueTransactionResponse, error) {
+	id, _, err := transaction.EnqueueInTx(ctx, tx, request)
+	if err != nil {
+		return commons.EnqueueTransactionResponse{}, fmt.Errorf("failed to enqueue transaction: %w", err)
+	}
+	return commons.EnqueueTransactionResponse{ID: id}, nil
+}
+
+// CreateTables creates the tables used by the server, for callers which may start before the server does.
+func CreateTables(ctx context.Context, db *sql.DB) error {
+	return transaction.CreateTransactionsTableIfNotExist(ctx, db)
+}